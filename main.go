@@ -14,6 +14,7 @@ const (
 	DirRoutes       = "routes"
 	DirDist         = "dist"
 	DirStatic       = "static"
+	DirMocks        = "mocks"
 	FileStyleCSS    = "styles.css"
 	DirPreinstalled = "spec/components/preinstalled_components"
 )
@@ -47,33 +48,39 @@ func main() {
 	case "compile":
 		watch := false
 		path := ""
+		opts := gtml.CompileOptions{
+			ComponentsDir: DirComponents,
+			RoutesDir:     DirRoutes,
+			DistDir:       DirDist,
+			StaticDir:     DirStatic,
+		}
 		for _, arg := range os.Args[2:] {
 			if arg == "--watch" {
 				watch = true
+			} else if arg == "--shared-runtime" {
+				opts.SharedRuntime = true
+			} else if arg == "--minify" {
+				opts.Minify = true
+			} else if arg == "--fingerprint" {
+				opts.FingerprintAssets = true
+			} else if arg == "--static-fetch-urls" {
+				opts.StaticFetchURLs = true
+			} else if strings.HasPrefix(arg, "--scope-ids=") {
+				opts.ScopeIDs = strings.TrimPrefix(arg, "--scope-ids=")
 			} else if !strings.HasPrefix(arg, "-") && path == "" {
 				path = arg
 			}
 		}
 		if path == "" {
 			fmt.Println("Error: Missing path argument for compile.")
-			fmt.Println("Usage: gtml compile <PATH> [--watch]")
+			fmt.Println("Usage: gtml compile <PATH> [--watch] [--shared-runtime] [--minify] [--fingerprint] [--static-fetch-urls] [--scope-ids=name|hash|debug]")
 			os.Exit(1)
 		}
 
 		if watch {
-			gtml.WatchProject(path, gtml.CompileOptions{
-				ComponentsDir: DirComponents,
-				RoutesDir:     DirRoutes,
-				DistDir:       DirDist,
-				StaticDir:     DirStatic,
-			})
+			gtml.WatchProject(path, opts)
 		} else {
-			err := gtml.CompileProject(path, gtml.CompileOptions{
-				ComponentsDir: DirComponents,
-				RoutesDir:     DirRoutes,
-				DistDir:       DirDist,
-				StaticDir:     DirStatic,
-			})
+			err := gtml.CompileProject(path, opts)
 			if err != nil {
 				fmt.Printf("\n❌ Compilation failed: %v\n", err)
 				os.Exit(1)
@@ -81,6 +88,39 @@ func main() {
 			fmt.Println("\n✅ Compilation successful!")
 		}
 
+	case "serve":
+		path := ""
+		addr := "localhost:3000"
+		opts := gtml.CompileOptions{
+			ComponentsDir: DirComponents,
+			RoutesDir:     DirRoutes,
+			DistDir:       DirDist,
+			StaticDir:     DirStatic,
+		}
+		for _, arg := range os.Args[2:] {
+			if strings.HasPrefix(arg, "--port=") {
+				addr = "localhost:" + strings.TrimPrefix(arg, "--port=")
+			} else if arg == "--shared-runtime" {
+				opts.SharedRuntime = true
+			} else if arg == "--static-fetch-urls" {
+				opts.StaticFetchURLs = true
+			} else if strings.HasPrefix(arg, "--scope-ids=") {
+				opts.ScopeIDs = strings.TrimPrefix(arg, "--scope-ids=")
+			} else if !strings.HasPrefix(arg, "-") && path == "" {
+				path = arg
+			}
+		}
+		if path == "" {
+			fmt.Println("Error: Missing path argument for serve.")
+			fmt.Println("Usage: gtml serve <PATH> [--port=3000] [--shared-runtime] [--static-fetch-urls] [--scope-ids=name|hash|debug]")
+			os.Exit(1)
+		}
+
+		if err := gtml.ServeProject(path, addr, DirMocks, opts); err != nil {
+			fmt.Printf("\n❌ Serve failed: %v\n", err)
+			os.Exit(1)
+		}
+
 	case "test":
 		path := ""
 		for _, arg := range os.Args[2:] {
@@ -103,7 +143,8 @@ func printUsage() {
 	fmt.Println("gtml - A Static Site Generator")
 	fmt.Println("Usage:")
 	fmt.Println("  gtml init <PATH> [--force]")
-	fmt.Println("  gtml compile <PATH> [--watch]")
+	fmt.Println("  gtml compile <PATH> [--watch] [--shared-runtime] [--minify] [--fingerprint] [--static-fetch-urls] [--scope-ids=name|hash|debug]")
+	fmt.Println("  gtml serve <PATH> [--port=3000] [--shared-runtime] [--static-fetch-urls] [--scope-ids=name|hash|debug]")
 	fmt.Println("  gtml test [PATH]")
 }
 
@@ -121,6 +162,7 @@ func runInit(basePath string, force bool) {
 		filepath.Join(basePath, DirComponents),
 		filepath.Join(basePath, DirRoutes),
 		filepath.Join(basePath, DirStatic),
+		filepath.Join(basePath, DirMocks),
 		filepath.Join(basePath, DirDist),
 		filepath.Join(basePath, DirDist, DirStatic),
 	}
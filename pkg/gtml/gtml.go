@@ -1,12 +1,24 @@
 package gtml
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
+	"io"
 	"io/fs"
+	"maps"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,10 +31,26 @@ const (
 	PropTypeBoolean = "boolean"
 )
 
+// Scope ID strategies for CompileOptions.ScopeIDs
+const (
+	ScopeIDName  = "name"  // data-button
+	ScopeIDHash  = "hash"  // data-g-3fa9c1
+	ScopeIDDebug = "debug" // data-g-button-3fa9c1
+)
+
 var (
 	reComponentTag    = regexp.MustCompile(`</?([A-Z][a-zA-Z0-9]*)`)
-	reStyleBlock      = regexp.MustCompile(`(?s)<style>(.*?)</style>`)
+	reStyleBlock      = regexp.MustCompile(`(?s)<style(\s[^>]*)?>(.*?)</style>`)
+	reLinkTag         = regexp.MustCompile(`<link\s(?:[^>"']|"[^"]*"|'[^']*')*>`)
+	reScriptBody      = regexp.MustCompile(`(?s)<script>(.*?)</script>`)
+	reStylePropRef    = regexp.MustCompile(`\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}`)
+	reStylePropVar    = regexp.MustCompile(`var\(--gtml-([a-zA-Z_][a-zA-Z0-9_]*)\)`)
+	reCSSURL          = regexp.MustCompile(`url\(\s*(['"]?)([^'"()?#\s]+)([^'"()\s]*)['"]?\s*\)`)
+	reStyleDirective  = regexp.MustCompile(`\s+style:(--[a-zA-Z0-9_-]+)\s*=\s*(\{[^{}]*\}|'[^']*'|"[^"]*")`)
+	reStyleAttr       = regexp.MustCompile(`\sstyle\s*=\s*(?:'([^']*)'|"([^"]*)")`)
 	rePropsAttr       = regexp.MustCompile(`\s+props\s*=\s*['"]([^'"]+)['"]`)
+	reEmitsAttr       = regexp.MustCompile(`\s+emits\s*=\s*['"]([^'"]*)['"]`)
+	reEventName       = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_:.-]*$`)
 	reExpression      = regexp.MustCompile(`\{([^{}]+)\}`)
 	reSlotPlaceholder = regexp.MustCompile(`(?s)<slot\s+name=['"](\w+)['"]\s*/?>`)
 	reSlotUsage       = regexp.MustCompile(`(?s)<slot\s+([^>]+)>(.*?)</slot>`)
@@ -31,16 +59,37 @@ var (
 	reFetchAttr    = regexp.MustCompile(`\s+fetch\s*=\s*['"]([^'"]+)['"]`)
 	reAsAttr       = regexp.MustCompile(`\s+as\s*=\s*['"]([^'"]+)['"]`)
 	reForAttr      = regexp.MustCompile(`\s+for\s*=\s*['"]([^'"]+)['"]`)
-	reSuspenseAttr = regexp.MustCompile(`\s+suspense(\s|>|/)`)
-	reFallbackAttr = regexp.MustCompile(`\s+fallback(\s|>|/)`)
+	reForKeyAttr   = regexp.MustCompile(`\s+key\s*=\s*(?:'([^']*)'|"([^"]*)"|\{([^{}]*)\})`)
+	reSuspenseAttr = regexp.MustCompile(`\s+suspense(\s|>|/|$)`)
+	reFallbackAttr = regexp.MustCompile(`\s+fallback(\s|>|/|$)`)
+	reFallbackCode = regexp.MustCompile(`\s+fallback\s*=\s*['"]([^'"]*)['"]`)
+	reStatusCode   = regexp.MustCompile(`^[1-5](\d\d|xx)$`)
+	reFetchOption  = regexp.MustCompile(`\s+fetch-(headers|body|credentials|mode|interval|cache)(?:\s*=\s*(?:'([^']*)'|"([^"]*)"))?`)
+	reFetchSignal  = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+	reFetchURLRead = regexp.MustCompile(`\{\$([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+	reTagAttr      = regexp.MustCompile(`\s+([^\s"'<>/=]+)(\s*=\s*(?:"[^"]*"|'[^']*'|\{[^}]*\}|[^\s"'=<>` + "`" + `]+))?`)
+	reURLAttr      = regexp.MustCompile(`(?i)` + urlAttrPattern)
+	reScriptURL    = regexp.MustCompile(`(?i)` + scriptURLPattern)
+
+	// Form-related regex patterns
+	reFormAction       = regexp.MustCompile(`\s+action\s*=\s*['"]((?i:GET|POST|PUT|PATCH|DELETE))\s+([^'"]+)['"]`)
+	reFormMethod       = regexp.MustCompile(`^(?i:GET|POST|PUT|PATCH|DELETE)\s+\S`)
+	reSuccessAttr      = regexp.MustCompile(`\s+success(\s|>|/|$)`)
+	reRefetchAttr      = regexp.MustCompile(`\s+refetch\s*=\s*['"]([^'"]*)['"]`)
+	reEnctypeMultipart = regexp.MustCompile(`\s+enctype\s*=\s*['"]multipart/form-data['"]`)
 
 	// Interactivity-related regex patterns
-	reGtmlScript      = regexp.MustCompile(`(?s)<script\s+type\s*=\s*['"]gtml['"]\s*>(.*?)</script>`)
-	reInlineGtmlEvent = regexp.MustCompile(`(?s)\s(on[a-z]+)=\{\(\)\s*=>\s*\{([\s\S]*?)\}\}`)
-	reSignalAccess    = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
-	reSignalSet       = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*(.+)`)
-	reElementSel      = regexp.MustCompile(`#([a-zA-Z_-][a-zA-Z0-9_-]*)(\*?)`)
-	reClassSel        = regexp.MustCompile(`\.([a-zA-Z_-][a-zA-Z0-9_-]*)(\*?)`)
+	reGtmlScript        = regexp.MustCompile(`(?s)<script\s+type\s*=\s*['"]gtml['"]\s*>(.*?)</script>`)
+	reInlineGtmlEvent   = regexp.MustCompile(`(?s)\s(on[a-z]+)=\{\(\)\s*=>\s*\{([\s\S]*?)\}\}`)
+	reSignalAccess      = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+	reTagName           = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*`)
+	reIdentifier        = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	reListFor           = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s+in\s+\$([a-zA-Z_][a-zA-Z0-9_]*)\s*$`)
+	reListForAttr       = regexp.MustCompile(`\sfor=['"]\s*([a-zA-Z_][a-zA-Z0-9_]*)\s+in\s+\$[a-zA-Z_][a-zA-Z0-9_]*\s*['"]`)
+	reSignalIf          = regexp.MustCompile(`\sif=\{`)
+	reListKeyAttr       = regexp.MustCompile(`\skey=('[^']*'|"[^"]*"|\{[^{}]*\})`)
+	reListLoopAttrs     = regexp.MustCompile(`\s+(?:for|key)=(?:'[^']*'|"[^"]*"|\{[^{}]*\})`)
+	reSignalPlaceholder = regexp.MustCompile(`\{(\$?)([a-zA-Z_][a-zA-Z0-9_]*)\}`)
 )
 
 type PropDef struct {
@@ -57,12 +106,24 @@ type Component struct {
 	ScopeID     string
 	Path        string
 	PropDefs    map[string]PropDef
+	Emits       []string
 }
 
 type GlobalState struct {
 	Components      map[string]*Component
 	CSSOutput       strings.Builder
 	InteractivityJS strings.Builder
+
+	// SharedRuntime moves generated scripts out of the page. The signal and fetch
+	// helpers are expected in a shared runtime file and every generated script,
+	// including fetch scripts, is collected in InteractivityJS for a per-route chunk.
+	SharedRuntime bool
+
+	// BasePath is the project directory. Static fetch elements read their files from it.
+	BasePath string
+
+	// StaticFetchURLs lets static fetch elements request http(s) urls
+	StaticFetchURLs bool
 }
 
 type Value struct {
@@ -78,6 +139,14 @@ type FetchElement struct {
 	Method       string // HTTP method (GET, POST, etc.)
 	URL          string // URL to fetch from
 	AsName       string // Name for the data (from 'as' attribute)
+	Headers      string // Raw fetch-headers value ('Name: value; Name: value')
+	Body         string // Raw fetch-body value ('key: value, key: value' or '$signal')
+	Credentials  string // Value of fetch-credentials
+	Mode         string // Value of fetch-mode
+	Interval     string // Value of fetch-interval, e.g. '30s'
+	Cache        bool   // Whether the element has fetch-cache
+	Static       bool   // Whether the element has static and is resolved at compile time
+	CacheMaxAge  string // Value of fetch-cache, how long cached data is fresh
 	StartIdx     int    // Start position in HTML
 	EndIdx       int    // End position in HTML
 	TagName      string // The HTML tag name
@@ -88,6 +157,7 @@ type FetchElement struct {
 // ForLoop represents a for iteration expression
 type ForLoop struct {
 	ItemName   string // Name of each item (e.g., 'user')
+	IndexName  string // Optional name of the index (e.g., 'i' in 'user, i in users')
 	SourceName string // Name of the source data (e.g., 'users')
 	SourcePath string // Full path for nested access (e.g., 'user.colors')
 	TemplateID string // Unique ID for the template element
@@ -110,6 +180,10 @@ func (v Value) String() string {
 
 func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, isTopLevel bool) (string, error) {
 	var err error
+	html, err = compileSignalTernaries(html)
+	if err != nil {
+		return "", err
+	}
 	html, err = evaluateTernaries(html, scopeProps)
 	if err != nil {
 		return "", err
@@ -138,13 +212,21 @@ func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, i
 
 		slotsMap := extractSlots(compiledChildren)
 
-		renderedComp := compDef.Template
+		// Ternaries on signals switch markup at runtime instead of at compile time
+		renderedComp, err := compileSignalTernaries(compDef.Template)
+		if err != nil {
+			return "", fmt.Errorf("error compiling signal conditionals in %s: %v", tagName, err)
+		}
 
-		// Extract prop signals from gtml script BEFORE processing
-		propSignals := extractPropSignals(renderedComp)
+		// Every rendered instance of an interactive component gets its own signal namespace
+		instanceID := ""
+		if isInteractive(renderedComp) {
+			instanceCounter++
+			instanceID = fmt.Sprintf("i%d", instanceCounter)
+		}
 
 		// Process gtml scripts and mark signal expressions BEFORE expression evaluation
-		renderedComp, gtmlScript, err := ProcessGtmlScripts(renderedComp, props)
+		renderedComp, gtmlScript, err := ProcessGtmlScripts(renderedComp, props, instanceID)
 		if err != nil {
 			return "", fmt.Errorf("error processing gtml scripts in %s: %v", tagName, err)
 		}
@@ -153,7 +235,7 @@ func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, i
 		}
 
 		// Process inline gtml events
-		renderedComp, inlineScript, err := ProcessInlineEvents(renderedComp, props)
+		renderedComp, inlineScript, err := ProcessInlineEvents(renderedComp, props, instanceID)
 		if err != nil {
 			return "", fmt.Errorf("error processing inline events in %s: %v", tagName, err)
 		}
@@ -161,36 +243,25 @@ func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, i
 			state.InteractivityJS.WriteString(inlineScript)
 		}
 
-		// Mark signal expressions in the template for runtime rendering
-		// This is done BEFORE expression evaluation
-		signalNames := extractSignalNames(gtmlScript)
-		inlineSignalNames := extractSignalNames(inlineScript)
-		for sigName := range inlineSignalNames {
-			signalNames[sigName] = true
+		// Signal expressions in attributes and text become reactive bindings
+		renderedComp, bindingScript, err := ProcessSignalBindings(renderedComp, props, instanceID)
+		if err != nil {
+			return "", fmt.Errorf("error processing signal bindings in %s: %v", tagName, err)
 		}
-		for sigName := range signalNames {
-			markerRe := regexp.MustCompile(`\{` + sigName + `\}`)
-			renderedComp = markerRe.ReplaceAllString(renderedComp, fmt.Sprintf("{gtml-signal-%s}", sigName))
+		if bindingScript != "" {
+			state.InteractivityJS.WriteString(bindingScript)
 		}
 
 		// Protect fetch expressions before evaluation
 		renderedComp = protectFetchExpressions(renderedComp)
+		renderedComp = protectFormTemplates(renderedComp)
 
-		renderedComp, err = EvaluateExpressions(renderedComp, props)
+		// Merge style:--name directives into style attributes with their values evaluated
+		renderedComp, err = applyStyleDirectives(renderedComp, props)
 		if err != nil {
 			return "", fmt.Errorf("error evaluating expressions in %s: %v", tagName, err)
 		}
 
-		// Restore escaped braces in event handlers
-		renderedComp = strings.ReplaceAll(renderedComp, "&#123;", "{")
-		renderedComp = strings.ReplaceAll(renderedComp, "&#125;", "}")
-
-		// Replace the signal markers with spans for runtime rendering
-		for sigName := range signalNames {
-			markerRe := regexp.MustCompile(`\{gtml-signal-` + sigName + `\}`)
-			renderedComp = markerRe.ReplaceAllString(renderedComp, fmt.Sprintf("<span data-gtml-signal-value='%s'></span>", sigName))
-		}
-
 		renderedComp, err = EvaluateExpressions(renderedComp, props)
 		if err != nil {
 			return "", fmt.Errorf("error evaluating expressions in %s: %v", tagName, err)
@@ -199,29 +270,8 @@ func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, i
 		// Restore fetch expressions after all evaluations are done
 		renderedComp = restoreFetchExpressions(renderedComp)
 
-		// Add data attributes for prop signals
-		for propName := range propSignals {
-			attrName := fmt.Sprintf("data-gtml-prop-%s", propName)
-			if propValue, ok := props[propName]; ok {
-				serializedValue := propValue.String()
-				// Add the attribute to the first element of the component
-				if strings.HasPrefix(strings.TrimSpace(renderedComp), "<") {
-					firstSpace := strings.IndexAny(renderedComp, " >")
-					if firstSpace != -1 {
-						if renderedComp[firstSpace] == ' ' {
-							// Has attributes, insert after first space
-							insertPos := firstSpace + 1
-							for insertPos < len(renderedComp) && renderedComp[insertPos] == ' ' {
-								insertPos++
-							}
-							renderedComp = renderedComp[:insertPos] + fmt.Sprintf("%s='%s' ", attrName, serializedValue) + renderedComp[insertPos:]
-						} else if renderedComp[firstSpace] == '>' {
-							// No attributes, insert before >
-							renderedComp = renderedComp[:firstSpace] + fmt.Sprintf(" %s='%s'", attrName, serializedValue) + renderedComp[firstSpace:]
-						}
-					}
-				}
-			}
+		if instanceID != "" {
+			renderedComp = addRootAttribute(renderedComp, "data-gtml-instance", instanceID)
 		}
 
 		renderedComp = reSlotPlaceholder.ReplaceAllStringFunc(renderedComp, func(match string) string {
@@ -246,13 +296,17 @@ func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, i
 
 	// Process client-side fetch elements BEFORE evaluating remaining expressions
 	// This preserves expressions like {user.name} for client-side JavaScript
-	html, err = ProcessFetchElements(html)
+	html, err = processFetchElements(html, state)
+	if err != nil {
+		return "", err
+	}
+	html, err = processFormElements(html, state)
 	if err != nil {
 		return "", err
 	}
 
 	// Process inline gtml events at the top level
-	html, inlineScript, err := ProcessInlineEvents(html, scopeProps)
+	html, inlineScript, err := ProcessInlineEvents(html, scopeProps, "")
 	if err != nil {
 		return "", err
 	}
@@ -260,23 +314,54 @@ func CompileHTML(html string, state *GlobalState, scopeProps map[string]Value, i
 		state.InteractivityJS.WriteString(inlineScript)
 	}
 
-	html, err = EvaluateExpressions(html, scopeProps)
+	html, bindingScript, err := ProcessSignalBindings(html, scopeProps, "")
+	if err != nil {
+		return "", err
+	}
+	if bindingScript != "" {
+		state.InteractivityJS.WriteString(bindingScript)
+	}
+
+	html, err = applyStyleDirectives(html, scopeProps)
 	if err != nil {
 		return "", err
 	}
 
-	// Restore escaped braces in event handlers
-	html = strings.ReplaceAll(html, "&#123;", "{")
-	html = strings.ReplaceAll(html, "&#125;", "}")
+	html, err = EvaluateExpressions(html, scopeProps)
+	if err != nil {
+		return "", err
+	}
 
-	// Append interactivity scripts to the HTML only at the top level
-	if isTopLevel && state.InteractivityJS.Len() > 0 {
+	// Append interactivity scripts to the HTML only at the top level.
+	// With a shared runtime the caller links the runtime and route chunk instead.
+	if isTopLevel && !state.SharedRuntime && state.InteractivityJS.Len() > 0 {
 		html = html + "\n<script>\n" + SignalLibrary + "\n</script>\n" + state.InteractivityJS.String()
 	}
 
 	return html, nil
 }
 
+// addRootAttribute adds name='value' to the first element of html
+func addRootAttribute(html string, name string, value string) string {
+	if !strings.HasPrefix(strings.TrimSpace(html), "<") {
+		return html
+	}
+	firstSpace := strings.IndexAny(html, " >")
+	if firstSpace == -1 {
+		return html
+	}
+	if html[firstSpace] == ' ' {
+		// Has attributes, insert after first space
+		insertPos := firstSpace + 1
+		for insertPos < len(html) && html[insertPos] == ' ' {
+			insertPos++
+		}
+		return html[:insertPos] + fmt.Sprintf("%s='%s' ", name, value) + html[insertPos:]
+	}
+	// No attributes, insert before >
+	return html[:firstSpace] + fmt.Sprintf(" %s='%s'", name, value) + html[firstSpace:]
+}
+
 func extractSlots(content string) map[string]string {
 	slots := make(map[string]string)
 	matches := reSlotUsage.FindAllStringSubmatchIndex(content, -1)
@@ -442,6 +527,53 @@ func evaluateTernaries(html string, props map[string]Value) (string, error) {
 	return result, nil
 }
 
+// compileSignalTernaries rewrites { $cond ? (<A/>) : (<B/>) } into two branches
+// guarded by if={$cond} and if={!($cond)} so they are toggled at runtime. Inside a
+// reactive list, ternaries on the loop item are rewritten the same way.
+// Ternaries that don't read a signal are left for evaluateTernaries.
+func compileSignalTernaries(html string) (string, error) {
+	result := html
+	offset := 0
+	for {
+		ternaryStart := findTernaryStart(result[offset:])
+		if ternaryStart == -1 {
+			break
+		}
+		ternaryStart += offset
+
+		ternaryEnd, condition, truthy, falsy, err := parseTernary(result, ternaryStart)
+		if err != nil {
+			return "", err
+		}
+		if !reSignalAccess.MatchString(condition) && !readsListVar(condition, listVarsAt(result, ternaryStart)) {
+			offset = ternaryStart + 1
+			continue
+		}
+
+		condition = strings.TrimSpace(condition)
+		replacement := conditionalBranch(truthy, condition) + conditionalBranch(falsy, "!("+condition+")")
+		result = result[:ternaryStart] + replacement + result[ternaryEnd:]
+		offset = ternaryStart
+	}
+	return result, nil
+}
+
+// conditionalBranch adds if={condition} to a branch with a single root element,
+// or wraps the branch in an element that doesn't affect layout
+func conditionalBranch(content string, condition string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+	if content[0] == '<' && len(content) > 1 && content[1] >= 'a' && content[1] <= 'z' {
+		if startIdx, endIdx, tagName, _, _, _ := findElementAt(content, 0); startIdx == 0 && endIdx == len(content) {
+			nameEnd := 1 + len(tagName)
+			return content[:nameEnd] + " if={" + condition + "}" + content[nameEnd:]
+		}
+	}
+	return "<div style='display: contents' if={" + condition + "}>" + content + "</div>"
+}
+
 func findTernaryStart(s string) int {
 	for i := 0; i < len(s); i++ {
 		if s[i] == '{' {
@@ -466,6 +598,9 @@ func findTernaryStart(s string) int {
 					} else if s[j] == '(' && hasQuestion {
 						hasParen = true
 						return i
+					} else if hasQuestion && !unicode.IsSpace(rune(s[j])) {
+						// A value ternary like {a ? "(b)" : c}, branches start with '('
+						break
 					}
 				}
 			}
@@ -971,6 +1106,111 @@ func ParsePropsAttribute(template string) (map[string]PropDef, string, error) {
 	return propDefs, template, nil
 }
 
+// ParseEmitsAttribute reads the comma separated event names declared with
+// emits='cart:add, cart:remove' and removes the attribute from the template
+func ParseEmitsAttribute(template string) ([]string, string, error) {
+	matches := reEmitsAttr.FindAllStringSubmatch(template, -1)
+	if matches == nil {
+		return nil, template, nil
+	}
+	if len(matches) > 1 {
+		return nil, "", fmt.Errorf("only one emits attribute is allowed, found %d", len(matches))
+	}
+	match := matches[0]
+	template = reEmitsAttr.ReplaceAllString(template, "")
+
+	var emits []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(match[1], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !reEventName.MatchString(name) {
+			return nil, "", fmt.Errorf("invalid event name '%s'", name)
+		}
+		if seen[name] {
+			return nil, "", fmt.Errorf("duplicate event name: %s", name)
+		}
+		seen[name] = true
+		emits = append(emits, name)
+	}
+	return emits, template, nil
+}
+
+// EmittedEvents returns the event names passed as string literals to emit()
+// in a template's gtml scripts and inline events
+func EmittedEvents(template string) []string {
+	events, _ := scanEmits(template)
+	return events
+}
+
+// scanEmits returns the literal event names passed to emit() in a template, and
+// the expressions of the names that aren't literals
+func scanEmits(template string) ([]string, []string) {
+	var code []string
+	for _, m := range reGtmlScript.FindAllStringSubmatch(template, -1) {
+		code = append(code, m[1])
+	}
+	for _, m := range reInlineGtmlEvent.FindAllStringSubmatch(template, -1) {
+		code = append(code, m[2])
+	}
+
+	var events, dynamic []string
+	seen := make(map[string]bool)
+	for _, c := range code {
+		toks := tokenizeGtmlScript(c)
+		for i, tok := range toks {
+			if tok.kind != jsIdent || tok.text != "emit" || isJSMember(toks, i) {
+				continue
+			}
+			open := nextJSToken(toks, i+1)
+			if open == -1 || toks[open].text != "(" {
+				continue
+			}
+			arg := nextJSToken(toks, open+1)
+			if arg == -1 {
+				continue
+			}
+			// A template literal without substitutions is a literal name too
+			end := findJSExprEnd(toks, arg)
+			literal := toks[arg].kind == jsString || toks[arg].kind == jsTemplate && !strings.Contains(toks[arg].text, "${")
+			if !literal || end != arg+1 {
+				var expr strings.Builder
+				for _, t := range toks[arg:max(end, arg+1)] {
+					expr.WriteString(t.text)
+				}
+				dynamic = append(dynamic, expr.String())
+				continue
+			}
+			name := toks[arg].text[1 : len(toks[arg].text)-1]
+			if !seen[name] {
+				seen[name] = true
+				events = append(events, name)
+			}
+		}
+	}
+	return events, dynamic
+}
+
+// ValidateEmits checks that every event a component emits is declared in its emits attribute
+func ValidateEmits(name string, template string, declared []string) error {
+	allowed := make(map[string]bool)
+	for _, event := range declared {
+		allowed[event] = true
+	}
+	events, dynamic := scanEmits(template)
+	if len(dynamic) > 0 {
+		return fmt.Errorf("component '%s' emits an event named by '%s': emit names must be string literals so they can be checked against emits", name, dynamic[0])
+	}
+	for _, event := range events {
+		if !allowed[event] {
+			return fmt.Errorf("component '%s' emits '%s' but does not declare it in emits", name, event)
+		}
+	}
+	return nil
+}
+
 func ParseAttributes(attrStr string) map[string]string {
 	reAttrs := regexp.MustCompile(`(\w+)=["']([^"']*)["']`)
 	matches := reAttrs.FindAllStringSubmatch(attrStr, -1)
@@ -1096,22 +1336,50 @@ func HasSingleRoot(html string) bool {
 }
 
 func ProcessComponentStyles(raw string, scopeID string) (string, string, error) {
-	loc := reStyleBlock.FindStringSubmatchIndex(raw)
-	if loc == nil {
+	matches := reStyleBlock.FindAllStringSubmatchIndex(raw, -1)
+	if matches == nil {
 		return raw, "", nil
 	}
 
-	cssContent := raw[loc[2]:loc[3]]
-	htmlContent := raw[:loc[0]] + raw[loc[1]:]
-	htmlContent = strings.TrimSpace(htmlContent)
+	var scopedCSS strings.Builder
+	var htmlContent strings.Builder
+	last := 0
+	for _, loc := range matches {
+		attrs := map[string]string{}
+		if loc[2] != -1 {
+			attrs = parseTagAttributes(raw[loc[2]:loc[3]])
+		}
+		if lang, ok := attrs["lang"]; ok && lang != "css" {
+			return "", "", fmt.Errorf("unsupported style lang '%s': only css is supported", lang)
+		}
+
+		// Prop references like {color} become per-instance custom properties
+		cssContent := mapCSSCode(raw[loc[4]:loc[5]], func(code string) string {
+			return reStylePropRef.ReplaceAllString(code, "var(--gtml-$1)")
+		})
+		css := scopeCSS(cssContent, scopeID)
+		if media := attrs["media"]; media != "" && css != "" {
+			css = "@media " + media + " {\n" + css + "}\n"
+		}
+		scopedCSS.WriteString(css)
+
+		htmlContent.WriteString(raw[last:loc[0]])
+		last = loc[1]
+	}
+	htmlContent.WriteString(raw[last:])
+
+	return strings.TrimSpace(htmlContent.String()), scopedCSS.String(), nil
+}
 
+// scopeCSS prefixes every selector in css with the component's scope attribute
+func scopeCSS(cssContent string, scopeID string) string {
 	var scopedCSS strings.Builder
-	blocks := strings.Split(cssContent, "}")
+	blocks := splitCSSCode(cssContent, '}')
 	for _, block := range blocks {
 		if strings.TrimSpace(block) == "" {
 			continue
 		}
-		parts := strings.Split(block, "{")
+		parts := splitCSSCode(block, '{')
 		if len(parts) != 2 {
 			continue
 		}
@@ -1130,8 +1398,276 @@ func ProcessComponentStyles(raw string, scopeID string) (string, string, error)
 		}
 		scopedCSS.WriteString(strings.Join(newSels, ", ") + " {" + body + "}\n")
 	}
+	return scopedCSS.String()
+}
+
+// cssCodeEnd returns the end of the string or comment starting at i, or -1 when
+// css[i] starts neither
+func cssCodeEnd(css string, i int) int {
+	switch {
+	case css[i] == '"' || css[i] == '\'':
+		return skipQuoted(css, i)
+	case css[i] == '/' && i+1 < len(css) && css[i+1] == '*':
+		if end := strings.Index(css[i+2:], "*/"); end != -1 {
+			return i + end + 4
+		}
+		return len(css)
+	}
+	return -1
+}
+
+// mapCSSCode applies fn to the parts of css outside strings and comments
+func mapCSSCode(css string, fn func(string) string) string {
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(css); i++ {
+		if end := cssCodeEnd(css, i); end != -1 {
+			out.WriteString(fn(css[last:i]))
+			out.WriteString(css[i:end])
+			last, i = end, end-1
+		}
+	}
+	out.WriteString(fn(css[last:]))
+	return out.String()
+}
+
+// splitCSSCode splits css around sep, ignoring separators in strings and comments
+func splitCSSCode(css string, sep byte) []string {
+	var parts []string
+	last := 0
+	for i := 0; i < len(css); i++ {
+		if end := cssCodeEnd(css, i); end != -1 {
+			i = end - 1
+		} else if css[i] == sep {
+			parts = append(parts, css[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, css[last:])
+}
+
+// StyleProps returns the sorted names of the props referenced by scoped css
+func StyleProps(css string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	mapCSSCode(css, func(code string) string {
+		for _, match := range reStylePropVar.FindAllStringSubmatch(code, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+		return code
+	})
+	sort.Strings(names)
+	return names
+}
+
+// InjectStyleProps adds a style:--gtml-<prop>={prop} directive to the root element
+// for every prop the component's styles reference
+func InjectStyleProps(html string, propNames []string) string {
+	if len(propNames) == 0 {
+		return html
+	}
+	clean := strings.TrimSpace(html)
+	firstSpace := strings.IndexAny(clean, " />")
+	if firstSpace == -1 {
+		return html
+	}
+	var directives strings.Builder
+	for _, name := range propNames {
+		directives.WriteString(fmt.Sprintf(" style:--gtml-%s={%s}", name, name))
+	}
+	return clean[:firstSpace] + directives.String() + clean[firstSpace:]
+}
+
+// ApplyStyleDirectives merges style:--name={expr} directives on plain elements into
+// the element's style attribute as CSS custom properties
+func ApplyStyleDirectives(html string) string {
+	result, _ := applyStyleDirectives(html, nil)
+	return result
+}
+
+// applyStyleDirectives merges style directives like ApplyStyleDirectives. With props,
+// {expr} values are evaluated and escaped so a value can't end the declaration or
+// the attribute.
+func applyStyleDirectives(html string, props map[string]Value) (string, error) {
+	if !strings.Contains(html, "style:--") {
+		return html, nil
+	}
+
+	var result strings.Builder
+	i := 0
+	for i < len(html) {
+		if html[i] != '<' || i+1 >= len(html) || html[i+1] < 'a' || html[i+1] > 'z' {
+			result.WriteByte(html[i])
+			i++
+			continue
+		}
+		end := findTagEnd(html, i)
+		if end == -1 {
+			result.WriteString(html[i:])
+			break
+		}
+		tag, err := applyStyleDirectivesToTag(html[i:end+1], props)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(tag)
+		i = end + 1
+	}
+	return result.String(), nil
+}
+
+// findTagEnd returns the index of the '>' closing the tag that starts at start,
+// skipping over quoted attribute values and {expressions}
+func findTagEnd(html string, start int) int {
+	depth := 0
+	quote := byte(0)
+	for i := start + 1; i < len(html); i++ {
+		c := html[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+func applyStyleDirectivesToTag(tag string, props map[string]Value) (string, error) {
+	matches := reStyleDirective.FindAllStringSubmatch(tag, -1)
+	if matches == nil {
+		return tag, nil
+	}
+	tag = reStyleDirective.ReplaceAllString(tag, "")
+
+	var decls []string
+	for _, m := range matches {
+		value := m[2]
+		switch {
+		case value[0] == '\'' || value[0] == '"':
+			value = value[1 : len(value)-1]
+		case props != nil && isStaticStyleExpression(value[1:len(value)-1]):
+			evaluated, err := EvaluateExpression(value[1:len(value)-1], props)
+			if err != nil {
+				return "", err
+			}
+			value = escapeStyleValue(evaluated.String())
+		}
+		decls = append(decls, m[1]+": "+value)
+	}
+	declStr := strings.Join(decls, "; ")
+
+	if loc := reStyleAttr.FindStringSubmatchIndex(tag); loc != nil {
+		quote, valStart, valEnd := "'", loc[2], loc[3]
+		if valStart == -1 {
+			quote, valStart, valEnd = "\"", loc[4], loc[5]
+		}
+		existing := strings.TrimRight(strings.TrimSpace(tag[valStart:valEnd]), ";")
+		merged := declStr
+		if existing != "" {
+			merged = existing + "; " + declStr
+		}
+		return tag[:loc[0]] + " style=" + quote + merged + quote + tag[loc[1]:], nil
+	}
+
+	insertPos := len(tag) - 1
+	if strings.HasSuffix(tag, "/>") {
+		insertPos = len(tag) - 2
+		for insertPos > 0 && tag[insertPos-1] == ' ' {
+			insertPos--
+		}
+	}
+	return tag[:insertPos] + fmt.Sprintf(" style=\"%s\"", declStr) + tag[insertPos:], nil
+}
+
+// isStaticStyleExpression reports whether a style directive's expression is evaluated
+// at compile time, signal placeholders and ternaries are left to EvaluateExpressions
+func isStaticStyleExpression(expr string) bool {
+	return !strings.HasPrefix(expr, "gtml-signal-") && !(strings.Contains(expr, "?") && strings.Contains(expr, "("))
+}
+
+// styleValueEscaper escapes a custom property value for a style attribute. CSS escapes
+// keep ; { } inside the value and HTML escapes keep quotes inside the attribute.
+var styleValueEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\;",
+	"{", "\\{",
+	"}", "\\}",
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"'", "&#39;",
+	"\"", "&quot;",
+)
+
+// escapeStyleValue escapes an evaluated value for a style:--name directive
+func escapeStyleValue(value string) string {
+	return styleValueEscaper.Replace(value)
+}
+
+// ResolveStylesheetLinks replaces <link rel="stylesheet"> tags pointing at files
+// relative to the component (./ or ../) with equivalent <style> blocks so they
+// are scoped and bundled like inline styles. Other links are left untouched.
+func ResolveStylesheetLinks(raw string, dir string) (string, error) {
+	var resolveErr error
+	result := reLinkTag.ReplaceAllStringFunc(raw, func(tag string) string {
+		if resolveErr != nil {
+			return tag
+		}
+		attrs := parseTagAttributes(tag)
+		href := attrs["href"]
+		if !strings.EqualFold(attrs["rel"], "stylesheet") || (!strings.HasPrefix(href, "./") && !strings.HasPrefix(href, "../")) {
+			return tag
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(href)))
+		if err != nil {
+			resolveErr = fmt.Errorf("error reading stylesheet '%s': %v", href, err)
+			return tag
+		}
+
+		openTag := "<style>"
+		if media := attrs["media"]; media != "" {
+			openTag = fmt.Sprintf("<style media='%s'>", html.EscapeString(media))
+		}
+		return openTag + "\n" + string(data) + "\n</style>"
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return result, nil
+}
 
-	return htmlContent, scopedCSS.String(), nil
+// parseTagAttributes reads the attributes of a tag like a browser does, with quoted
+// or unquoted values and character references decoded. Names are lowercased.
+func parseTagAttributes(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range reTagAttr.FindAllStringSubmatch(tag, -1) {
+		name := strings.ToLower(m[1])
+		if _, exists := attrs[name]; exists {
+			continue
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(m[2]), "="))
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		attrs[name] = html.UnescapeString(value)
+	}
+	return attrs
 }
 
 func InjectScopeID(html string, scopeID string) string {
@@ -1179,7 +1715,10 @@ const fetchExprMarker = "@@GTML_FETCH_EXPR@@"
 
 // protectFetchExpressions escapes expressions inside fetch elements so they aren't evaluated at compile time
 func protectFetchExpressions(html string) string {
-	result := html
+	// Signal reads in fetch urls are compiled for the runtime
+	result := reFetchAttr.ReplaceAllStringFunc(html, func(attr string) string {
+		return reFetchURLRead.ReplaceAllString(attr, fetchExprMarker+"OPEN"+fetchExprMarker+"$$${1}"+fetchExprMarker+"CLOSE"+fetchExprMarker)
+	})
 	offset := 0
 
 	for {
@@ -1258,6 +1797,12 @@ func restoreFetchExpressions(html string) string {
 
 // ProcessFetchElements processes HTML to find fetch elements and generate JavaScript
 func ProcessFetchElements(html string) (string, error) {
+	return processFetchElements(html, nil)
+}
+
+// processFetchElements inlines each fetch script after its element, or collects it
+// in the state's InteractivityJS when the state uses a shared runtime or the fetch reads signals
+func processFetchElements(html string, state *GlobalState) (string, error) {
 	result := html
 	fetchElements := findFetchElements(result)
 
@@ -1265,24 +1810,51 @@ func ProcessFetchElements(html string) (string, error) {
 		return result, nil
 	}
 
+	shared := state != nil && state.SharedRuntime
+	var sharedScripts []string
+
 	// Process each fetch element from end to start (to preserve indices)
 	for i := len(fetchElements) - 1; i >= 0; i-- {
 		fe := fetchElements[i]
 
+		// Static fetches are rendered now and need no script
+		if fe.Static {
+			basePath, allowURLs := "", false
+			if state != nil {
+				basePath, allowURLs = state.BasePath, state.StaticFetchURLs
+			}
+			rendered, err := renderStaticFetchElement(fe, basePath, allowURLs)
+			if err != nil {
+				return "", fmt.Errorf("error processing fetch element: %v", err)
+			}
+			result = result[:fe.StartIdx] + rendered + result[fe.EndIdx:]
+			continue
+		}
+
 		// Generate a unique ID for this fetch element
 		fetchCounter++
 		fe.ID = fmt.Sprintf("gtml-fetch-%d", fetchCounter)
 
 		// Process the element and generate JavaScript
-		processedElement, script, err := processSingleFetchElement(fe)
+		processedElement, script, readsSignals, err := processSingleFetchElement(fe, shared)
 		if err != nil {
 			return "", fmt.Errorf("error processing fetch element: %v", err)
 		}
 
+		// Fetches that read signals run after the signal library and component scripts
+		if shared || (state != nil && readsSignals) {
+			sharedScripts = append([]string{script}, sharedScripts...)
+			script = ""
+		}
+
 		// Replace the original element with the processed version and script
 		result = result[:fe.StartIdx] + processedElement + script + result[fe.EndIdx:]
 	}
 
+	for _, script := range sharedScripts {
+		state.InteractivityJS.WriteString(script)
+	}
+
 	return result, nil
 }
 
@@ -1354,6 +1926,9 @@ func findFetchElements(html string) []FetchElement {
 			FullElement:  html[startIdx:endIdx],
 		}
 
+		readFetchOptions(&fe, attrsStr)
+		fe.Static = findStaticAttr(attrsStr) != nil
+
 		if isSelfClosing {
 			fe.InnerContent = ""
 		}
@@ -1365,6 +1940,28 @@ func findFetchElements(html string) []FetchElement {
 	return elements
 }
 
+// readFetchOptions reads the fetch-* attributes of an element into fe
+func readFetchOptions(fe *FetchElement, attrsStr string) {
+	for _, m := range reFetchOption.FindAllStringSubmatch(attrsStr, -1) {
+		value := m[2] + m[3]
+		switch m[1] {
+		case "headers":
+			fe.Headers = value
+		case "body":
+			fe.Body = value
+		case "credentials":
+			fe.Credentials = value
+		case "mode":
+			fe.Mode = value
+		case "interval":
+			fe.Interval = value
+		case "cache":
+			fe.Cache = true
+			fe.CacheMaxAge = value
+		}
+	}
+}
+
 // findElementAt finds the element starting at the given position
 func findElementAt(html string, start int) (int, int, string, bool, string, string) {
 	if start >= len(html) || html[start] != '<' {
@@ -1450,10 +2047,33 @@ func countTagOccurrences(s, tagPrefix string) int {
 	return count
 }
 
-// processSingleFetchElement processes a single fetch element and returns the modified HTML and script
-func processSingleFetchElement(fe FetchElement) (string, string, error) {
+// processSingleFetchElement processes a single fetch element and returns the modified HTML and script,
+// and whether the request reads signals
+func processSingleFetchElement(fe FetchElement, shared bool) (string, string, bool, error) {
+	req, err := compileFetchRequest(fe)
+	if err != nil {
+		return "", "", false, err
+	}
+
 	// Extract suspense, fallback, and regular content
-	suspenseContent, fallbackContent, regularContent := extractFetchChildren(fe.InnerContent)
+	children := extractFetchChildren(fe.InnerContent)
+	for _, fallback := range children.Fallbacks {
+		if fallback.Status != "" && !reStatusCode.MatchString(fallback.Status) {
+			return "", "", false, fmt.Errorf("invalid fallback status %q: expected a code like '404' or a class like '5xx'", fallback.Status)
+		}
+	}
+	// Compile template expressions, they are evaluated against the fetched data at runtime
+	var expressions strings.Builder
+	regularContent, err := compileFetchTemplate(children.Regular, &expressions)
+	if err != nil {
+		return "", "", false, err
+	}
+	for i := range children.Fallbacks {
+		children.Fallbacks[i].Content, err = compileFetchTemplate(children.Fallbacks[i].Content, &expressions)
+		if err != nil {
+			return "", "", false, err
+		}
+	}
 
 	// Process for loops in the regular content
 	processedContent, forLoops := processForElements(regularContent)
@@ -1462,7 +2082,7 @@ func processSingleFetchElement(fe FetchElement) (string, string, error) {
 	// Find where the opening tag ends
 	openTagEnd := strings.Index(fe.FullElement, ">")
 	if openTagEnd == -1 {
-		return "", "", fmt.Errorf("invalid element: missing >")
+		return "", "", false, fmt.Errorf("invalid element: missing >")
 	}
 
 	// Get just the opening tag
@@ -1471,6 +2091,7 @@ func processSingleFetchElement(fe FetchElement) (string, string, error) {
 	// Remove fetch and as attributes from the opening tag
 	modifiedOpenTag := reFetchAttr.ReplaceAllString(openTag, "")
 	modifiedOpenTag = reAsAttr.ReplaceAllString(modifiedOpenTag, "")
+	modifiedOpenTag = reFetchOption.ReplaceAllString(modifiedOpenTag, "")
 
 	// Add the unique ID to the tag
 	// Find position to insert ID (after tag name)
@@ -1492,40 +2113,483 @@ func processSingleFetchElement(fe FetchElement) (string, string, error) {
 	modifiedElement := modifiedOpenTag + "</" + fe.TagName + ">"
 
 	// Generate the JavaScript
-	script := generateFetchScript(fe, suspenseContent, fallbackContent, processedContent, forLoops)
+	script := generateFetchScript(fe, req, children, processedContent, expressions.String(), forLoops, shared)
 
-	return modifiedElement, script, nil
+	return modifiedElement, script, req.ReadsSignals, nil
 }
 
-// extractFetchChildren extracts suspense, fallback, and regular content from fetch element children
-func extractFetchChildren(content string) (suspense, fallback, regular string) {
-	// Find and extract suspense element
-	suspenseStart := findElementWithAttr(content, "suspense")
-	if suspenseStart != -1 {
-		startIdx, endIdx, _, _, _, inner := findElementAt(content, suspenseStart)
-		if startIdx != -1 {
-			suspense = inner
-			content = content[:startIdx] + content[endIdx:]
-		}
-	}
+// staticFetchClient loads static fetch urls at compile time
+var staticFetchClient = &http.Client{Timeout: 10 * time.Second}
 
-	// Find and extract fallback element
-	fallbackStart := findElementWithAttr(content, "fallback")
-	if fallbackStart != -1 {
-		startIdx, endIdx, _, _, _, inner := findElementAt(content, fallbackStart)
-		if startIdx != -1 {
-			fallback = inner
-			content = content[:startIdx] + content[endIdx:]
+// renderStaticFetchElement resolves a fetch element marked static at compile time. The
+// template is rendered with the data the way the runtime would render it, so the page
+// gets plain html and no fetch script.
+func renderStaticFetchElement(fe FetchElement, basePath string, allowURLs bool) (string, error) {
+	if fe.Method != "GET" {
+		return "", fmt.Errorf("static fetch of %s must use GET, got %s", fe.URL, fe.Method)
+	}
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"headers", fe.Headers != ""},
+		{"body", fe.Body != ""},
+		{"credentials", fe.Credentials != ""},
+		{"mode", fe.Mode != ""},
+		{"interval", fe.Interval != ""},
+		{"cache", fe.Cache},
+	} {
+		if option.set {
+			return "", fmt.Errorf("static fetch of %s can't use fetch-%s", fe.URL, option.name)
 		}
 	}
+	if reFetchURLRead.MatchString(fe.URL) {
+		return "", fmt.Errorf("static fetch of %s can't read signals in its url", fe.URL)
+	}
 
-	regular = strings.TrimSpace(content)
-	return
-}
+	data, err := loadStaticFetchData(fe.URL, basePath, allowURLs)
+	if err != nil {
+		return "", err
+	}
 
-// findElementWithAttr finds the start position of an element with the given attribute
+	// Suspense and fallbacks are never shown, a failed static fetch fails the build
+	children := extractFetchChildren(fe.InnerContent)
+	content := children.Regular
+	if items, isList := data.([]any); children.Empty != "" && (data == nil || (isList && len(items) == 0)) {
+		content = children.Empty
+	}
+	rendered, err := renderStaticTemplate(content, map[string]any{fe.AsName: data})
+	if err != nil {
+		return "", err
+	}
+
+	openTag := fe.FullElement[:strings.Index(fe.FullElement, ">")+1]
+	openTag = reFetchAttr.ReplaceAllString(openTag, "")
+	openTag = reAsAttr.ReplaceAllString(openTag, "")
+	if loc := findStaticAttr(openTag); loc != nil {
+		openTag = openTag[:loc[0]] + openTag[loc[1]:]
+	}
+	openTag = strings.TrimSuffix(strings.TrimSuffix(openTag, ">"), "/") + ">"
+
+	return openTag + rendered + "</" + fe.TagName + ">", nil
+}
+
+// findStaticAttr returns the location of a standalone static attribute in a tag's
+// attributes, or nil. Attributes are matched with their values so a value like
+// class='card static' isn't mistaken for one.
+func findStaticAttr(attrs string) []int {
+	for _, loc := range reTagAttr.FindAllStringSubmatchIndex(attrs, -1) {
+		if attrs[loc[2]:loc[3]] == "static" && loc[4] == -1 {
+			return loc[:2]
+		}
+	}
+	return nil
+}
+
+// loadStaticFetchData reads the JSON for a static fetch. http(s) urls are requested when
+// allowURLs is set, anything else is a file path inside the project directory.
+func loadStaticFetchData(url string, basePath string, allowURLs bool) (any, error) {
+	var raw []byte
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		if !allowURLs {
+			return nil, fmt.Errorf("static fetch of %s requests a url at compile time: enable StaticFetchURLs (--static-fetch-urls) or read a file from the project", url)
+		}
+		resp, err := staticFetchClient.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("static fetch of %s failed: %v", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("static fetch of %s failed with status %d", url, resp.StatusCode)
+		}
+		raw, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("static fetch of %s failed: %v", url, err)
+		}
+	} else {
+		// Files are read through a root so neither .. nor a symlink can leave the project
+		name := filepath.FromSlash(strings.TrimPrefix(url, "/"))
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("static fetch of %s must read a file inside the project", url)
+		}
+		if basePath == "" {
+			basePath = "."
+		}
+		root, err := os.OpenRoot(basePath)
+		if err != nil {
+			return nil, fmt.Errorf("static fetch of %s failed: %v", url, err)
+		}
+		defer root.Close()
+		raw, err = root.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("static fetch of %s failed: %v", url, err)
+		}
+	}
+
+	var data any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("static fetch of %s returned invalid JSON: %v", url, err)
+	}
+	return data, nil
+}
+
+// renderStaticTemplate renders a fetch template with scope. Each for element is repeated
+// for its items with the item, index and loop in scope, and every other expression is
+// replaced with its escaped value.
+func renderStaticTemplate(content string, scope map[string]any) (string, error) {
+	var result strings.Builder
+	last, offset := 0, 0
+
+	for {
+		loc := reForAttr.FindStringIndex(content[offset:])
+		if loc == nil {
+			break
+		}
+		forAttrPos := offset + loc[0]
+		offset = forAttrPos + 1
+
+		elementStart := strings.LastIndexByte(content[:forAttrPos], '<')
+		if elementStart < last {
+			continue
+		}
+		startIdx, endIdx, tagName, _, attrsStr, _ := findElementAt(content, elementStart)
+		if startIdx == -1 {
+			continue
+		}
+		forMatch := reForAttr.FindStringSubmatch(attrsStr)
+		if forMatch == nil {
+			continue
+		}
+		// Attributes like <label for='email'> aren't loops
+		forLoop, err := ParseForAttribute(forMatch[1])
+		if err != nil {
+			continue
+		}
+
+		before, err := replaceStaticExpressions(content[last:startIdx], scope)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(before)
+
+		attrs := reForKeyAttr.ReplaceAllString(reForAttr.ReplaceAllString(attrsStr, ""), "")
+		element := "<" + tagName + attrs + content[startIdx+1+len(tagName)+len(attrsStr):endIdx]
+		items, err := renderStaticFor(element, forLoop, scope)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(items)
+
+		last, offset = endIdx, endIdx
+	}
+
+	rest, err := replaceStaticExpressions(content[last:], scope)
+	if err != nil {
+		return "", err
+	}
+	result.WriteString(rest)
+	return result.String(), nil
+}
+
+// renderStaticFor renders element once per item of the loop's source. Like the runtime,
+// a source that isn't a list renders nothing.
+func renderStaticFor(element string, forLoop ForLoop, scope map[string]any) (string, error) {
+	source, _ := fetchPathValue(scope, forLoop.SourcePath)
+	items, ok := source.([]any)
+	if !ok {
+		return "", nil
+	}
+
+	parent, hasParent := scope["loop"]
+	var result strings.Builder
+	for i, item := range items {
+		itemScope := maps.Clone(scope)
+		itemScope[forLoop.ItemName] = item
+		if forLoop.IndexName != "" {
+			itemScope[forLoop.IndexName] = float64(i)
+		}
+		loop := map[string]any{
+			"index":  float64(i),
+			"first":  i == 0,
+			"last":   i == len(items)-1,
+			"length": float64(len(items)),
+		}
+		if hasParent {
+			loop["parent"] = parent
+		}
+		itemScope["loop"] = loop
+
+		rendered, err := renderStaticTemplate(element, itemScope)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(rendered)
+	}
+	return result.String(), nil
+}
+
+// replaceStaticExpressions replaces template expressions the way replaceExpressions does
+// in the browser. Expressions reading a name the scope doesn't have are left as they are.
+func replaceStaticExpressions(html string, scope map[string]any) (string, error) {
+	var result strings.Builder
+	last := 0
+	for i := 0; i < len(html); i++ {
+		if html[i] != '{' || isInsideScriptTag(html, i) || isInsideStyleTag(html, i) {
+			continue
+		}
+		end := strings.IndexByte(html[i:], '}')
+		if end == -1 {
+			break
+		}
+		end += i
+		expr := strings.TrimSpace(html[i+1 : end])
+		raw := strings.HasPrefix(expr, "@html ")
+		if raw {
+			expr = strings.TrimSpace(expr[len("@html "):])
+		}
+		if expr == "" || expr[0] == '#' || expr[0] == '$' {
+			i = end
+			continue
+		}
+		// The output is evaluated again with the page, so literal braces are written as
+		// character references
+		if isLiteralBraces(expr) {
+			result.WriteString(html[last:i])
+			result.WriteString(staticBraceEscaper.Replace(html[i : end+1]))
+			last = end + 1
+			i = end
+			continue
+		}
+
+		value, ok, err := evalStaticExpression(expr, scope)
+		if err != nil {
+			return "", fmt.Errorf("invalid fetch template expression {%s}: %v", expr, err)
+		}
+		if !ok {
+			i = end
+			continue
+		}
+
+		text := toJSString(value)
+		if attr, inTag := attrContext(html, i); inTag {
+			if text, err = staticAttrValue(attr, text, scope); err != nil {
+				return "", fmt.Errorf("invalid fetch template expression {%s}: %v", expr, err)
+			}
+		} else if !raw {
+			text = fetchHTMLEscaper.Replace(text)
+		}
+		result.WriteString(html[last:i])
+		result.WriteString(text)
+		last = end + 1
+		i = end
+	}
+	result.WriteString(html[last:])
+	return result.String(), nil
+}
+
+// fetchHTMLEscaper escapes like escapeHTML in the fetch library
+var fetchHTMLEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#39;", "{", "&#123;", "}", "&#125;")
+
+// staticBraceEscaper keeps braces in static fetch output from being read as expressions
+var staticBraceEscaper = strings.NewReplacer("{", "&#123;", "}", "&#125;")
+
+// Template expressions in attributes follow the same rules wherever they are rendered:
+// event handler attributes can't interpolate data, URL attributes never get a script URL
+// and unquoted values are escaped so they can't end early.
+const (
+	urlAttrPattern   = `^(href|src|action|formaction|xlink:href|poster|background|cite|data)$`
+	scriptURLPattern = `^(javascript|vbscript|data):`
+)
+
+// templateAttr is the attribute a template expression is in. Name is empty when the
+// expression isn't inside an attribute value, Value is the value up to the expression.
+type templateAttr struct {
+	Name  string
+	Quote byte
+	Value string
+}
+
+// attrContext finds the attribute of the opening tag the expression at pos is in, and
+// whether pos is inside an opening tag at all. Matches _gtmlAttrContext in the fetch library.
+func attrContext(html string, pos int) (templateAttr, bool) {
+	if !isInsideTag(html, pos) {
+		return templateAttr{}, false
+	}
+	tag := html[strings.LastIndexByte(html[:pos], '<')+1 : pos]
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+	// next skips over earlier expressions, their text can contain spaces
+	next := func(i int) int {
+		if tag[i] == '{' {
+			if end := strings.IndexByte(tag[i:], '}'); end != -1 {
+				return i + end + 1
+			}
+		}
+		return i + 1
+	}
+
+	i := 0
+	for i < len(tag) && !isSpace(tag[i]) && tag[i] != '/' {
+		i = next(i)
+	}
+	for {
+		for i < len(tag) && (isSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && !isSpace(tag[i]) && tag[i] != '/' && tag[i] != '=' {
+			i = next(i)
+		}
+		if i >= len(tag) {
+			return templateAttr{}, true
+		}
+		name := tag[nameStart:i]
+		for i < len(tag) && isSpace(tag[i]) {
+			i++
+		}
+		if i >= len(tag) || tag[i] != '=' {
+			continue
+		}
+		i++
+		for i < len(tag) && isSpace(tag[i]) {
+			i++
+		}
+		if i >= len(tag) {
+			return templateAttr{Name: name}, true
+		}
+		if quote := tag[i]; quote == '"' || quote == '\'' {
+			end := strings.IndexByte(tag[i+1:], quote)
+			if end == -1 {
+				return templateAttr{Name: name, Quote: quote, Value: tag[i+1:]}, true
+			}
+			i += end + 2
+			continue
+		}
+		valueStart := i
+		for i < len(tag) && !isSpace(tag[i]) {
+			i = next(i)
+		}
+		if i >= len(tag) {
+			return templateAttr{Name: name, Value: tag[valueStart:]}, true
+		}
+	}
+}
+
+// staticAttrValue renders a template value inside an attribute like _gtmlAttrValue in
+// the fetch library, earlier expressions in the value are resolved against scope
+func staticAttrValue(attr templateAttr, text string, scope map[string]any) (string, error) {
+	if isEventAttr(attr.Name) {
+		return "", fmt.Errorf("data can't be put into the %s event attribute", attr.Name)
+	}
+	if reURLAttr.MatchString(attr.Name) {
+		before, err := replaceStaticExpressions(attr.Value, scope)
+		if err != nil {
+			return "", err
+		}
+		if isScriptURL(before + text) {
+			text = "about:blank"
+		}
+	}
+	if attr.Quote == 0 {
+		return escapeUnquotedAttr(text), nil
+	}
+	return fetchHTMLEscaper.Replace(text), nil
+}
+
+// isEventAttr reports whether an attribute is an event handler like onclick
+func isEventAttr(name string) bool {
+	return len(name) > 2 && strings.EqualFold(name[:2], "on")
+}
+
+// isScriptURL reports whether a URL runs script. Browsers ignore tabs and newlines
+// anywhere in a URL and control characters around it, so they are removed first.
+func isScriptURL(url string) bool {
+	url = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url)
+	return reScriptURL.MatchString(url)
+}
+
+// escapeUnquotedAttr escapes everything but a few URL-safe characters as a character
+// reference, like _gtmlEscapeUnquoted in the fetch library
+func escapeUnquotedAttr(text string) string {
+	var result strings.Builder
+	for _, r := range text {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_.-:/?#%@,;!~+*()", r)) {
+			result.WriteRune(r)
+		} else {
+			fmt.Fprintf(&result, "&#%d;", r)
+		}
+	}
+	return result.String()
+}
+
+// fetchChildren are the special children of a fetch element and the remaining template
+type fetchChildren struct {
+	Suspense  string
+	Empty     string
+	Fallbacks []fetchFallback
+	Regular   string
+}
+
+// fetchFallback is a fallback child. Status is '' for the default fallback, a code like
+// '404' or a class like '5xx'.
+type fetchFallback struct {
+	Status  string
+	Content string
+}
+
+// extractFetchChildren extracts suspense, empty, fallback, and regular content from fetch element children
+func extractFetchChildren(content string) fetchChildren {
+	var children fetchChildren
+
+	// Find and extract suspense element
+	suspenseStart := findElementWithAttr(content, "suspense")
+	if suspenseStart != -1 {
+		startIdx, endIdx, _, _, _, inner := findElementAt(content, suspenseStart)
+		if startIdx != -1 {
+			children.Suspense = inner
+			content = content[:startIdx] + content[endIdx:]
+		}
+	}
+
+	// Find and extract empty element
+	emptyStart := findElementWithAttr(content, "empty")
+	if emptyStart != -1 {
+		startIdx, endIdx, _, _, _, inner := findElementAt(content, emptyStart)
+		if startIdx != -1 {
+			children.Empty = inner
+			content = content[:startIdx] + content[endIdx:]
+		}
+	}
+
+	// Find and extract fallback elements, there may be one per status
+	for {
+		fallbackStart := findElementWithAttr(content, "fallback")
+		if fallbackStart == -1 {
+			break
+		}
+		startIdx, endIdx, _, _, attrs, inner := findElementAt(content, fallbackStart)
+		if startIdx == -1 {
+			break
+		}
+		status := ""
+		if m := reFallbackCode.FindStringSubmatch(attrs); m != nil {
+			status = strings.ToLower(strings.TrimSpace(m[1]))
+		}
+		children.Fallbacks = append(children.Fallbacks, fetchFallback{Status: status, Content: inner})
+		content = content[:startIdx] + content[endIdx:]
+	}
+
+	children.Regular = strings.TrimSpace(content)
+	return children
+}
+
+// findElementWithAttr finds the start position of an element with the given attribute
 func findElementWithAttr(html string, attrName string) int {
-	pattern := regexp.MustCompile(`<\w+[^>]*\s+` + attrName + `(\s|>|/)`)
+	pattern := regexp.MustCompile(`<\w+[^>]*\s+` + attrName + `(\s|>|/|=)`)
 	loc := pattern.FindStringIndex(html)
 	if loc == nil {
 		return -1
@@ -1599,8 +2663,24 @@ func processForElements(content string) (string, []ForLoop) {
 
 		// Remove for attribute and add template markers
 		newAttrs := reForAttr.ReplaceAllString(attrsStr, "")
-		newElement := fmt.Sprintf("<%s%s data-gtml-for=\"%s\" data-gtml-item=\"%s\" data-gtml-source=\"%s\" style=\"display:none\">%s</%s>",
-			tagName, newAttrs, templateID, forLoop.ItemName, forLoop.SourcePath, processedInner, tagName)
+		markers := fmt.Sprintf(" data-gtml-for=\"%s\" data-gtml-item=\"%s\"", templateID, forLoop.ItemName)
+		if forLoop.IndexName != "" {
+			markers += fmt.Sprintf(" data-gtml-index=\"%s\"", forLoop.IndexName)
+		}
+		markers += fmt.Sprintf(" data-gtml-source=\"%s\"", forLoop.SourcePath)
+
+		// Keys are scoped to their loop so nested lists can reuse ids
+		if keyMatch := reForKeyAttr.FindStringSubmatch(newAttrs); keyMatch != nil {
+			key := strings.TrimSpace(keyMatch[1] + keyMatch[2] + keyMatch[3])
+			if !strings.HasPrefix(key, "{") {
+				key = "{" + key + "}"
+			}
+			newAttrs = reForKeyAttr.ReplaceAllString(newAttrs, "")
+			markers += fmt.Sprintf(" data-gtml-key=\"%s:%s\"", templateID, key)
+		}
+
+		newElement := fmt.Sprintf("<%s%s%s style=\"display:none\">%s</%s>",
+			tagName, newAttrs, markers, processedInner, tagName)
 
 		result = result[:startIdx] + newElement + result[endIdx:]
 		offset = startIdx + len(newElement)
@@ -1609,395 +2689,2336 @@ func processForElements(content string) (string, []ForLoop) {
 	return result, forLoops
 }
 
-// ParseForAttribute parses a for attribute value like "user in users" or "color in user.colors"
-func ParseForAttribute(value string) (ForLoop, error) {
-	parts := strings.Split(strings.TrimSpace(value), " in ")
-	if len(parts) != 2 {
-		return ForLoop{}, fmt.Errorf("invalid for attribute format: expected 'item in items', got '%s'", value)
-	}
-
-	itemName := strings.TrimSpace(parts[0])
-	sourcePath := strings.TrimSpace(parts[1])
+// fetchExprCounter is used to generate unique keys for compiled fetch template expressions
+var fetchExprCounter int
 
-	// Get the base source name (first part before any dots)
-	sourceName := sourcePath
-	if idx := strings.Index(sourcePath, "."); idx != -1 {
-		sourceName = sourcePath[:idx]
-	}
+// reFetchPath matches template expressions the runtime resolves as a plain path
+var reFetchPath = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z0-9_]+)*$`)
 
-	return ForLoop{
-		ItemName:   itemName,
-		SourceName: sourceName,
-		SourcePath: sourcePath,
-	}, nil
-}
+// reJSNumber matches number literals that are written the same in JavaScript
+var reJSNumber = regexp.MustCompile(`^(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
 
-// generateFetchScript generates the JavaScript code for a fetch element
-func generateFetchScript(fe FetchElement, suspenseContent, fallbackContent, regularContent string, forLoops []ForLoop) string {
-	var script strings.Builder
-	script.WriteString("\n<script>\n(function() {\n")
+// compileFetchTemplate compiles every template expression that isn't a plain path, like
+// {user.age + 1}, and replaces it with a {#key} reference to the compiled function.
+// The functions are written to expressions as entries for gtmlFetchExpressions.
+func compileFetchTemplate(content string, expressions *strings.Builder) (string, error) {
+	var result strings.Builder
+	last := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] != '{' || isInsideScriptTag(content, i) || isInsideStyleTag(content, i) {
+			continue
+		}
+		end := strings.IndexByte(content[i:], '}')
+		if end == -1 {
+			break
+		}
+		end += i
+		expr := strings.TrimSpace(content[i+1 : end])
+		prefix := ""
+		if strings.HasPrefix(expr, "@html ") {
+			prefix = "@html "
+			expr = strings.TrimSpace(expr[len(prefix):])
+		}
+		if expr == "" || expr[0] == '#' || expr[0] == '$' || isLiteralBraces(expr) {
+			i = end
+			continue
+		}
+		if attr, _ := attrContext(content, i); isEventAttr(attr.Name) {
+			return "", fmt.Errorf("fetch template expression {%s} can't be used in the %s attribute: handle the event in a gtml script", expr, attr.Name)
+		}
+		if reFetchPath.MatchString(expr) {
+			i = end
+			continue
+		}
 
-	// Get references to the container
-	script.WriteString(fmt.Sprintf("  const container = document.getElementById('%s');\n", fe.ID))
-	script.WriteString("  if (!container) return;\n\n")
+		js, roots, err := compileFetchExpression(expr)
+		if err != nil {
+			return "", fmt.Errorf("invalid fetch template expression {%s}: %v", expr, err)
+		}
+		fetchExprCounter++
+		quoted := make([]string, len(roots))
+		for j, root := range roots {
+			quoted[j] = "'" + root + "'"
+		}
+		expressions.WriteString(fmt.Sprintf("    %d: { roots: [%s], fn: s => %s },\n", fetchExprCounter, strings.Join(quoted, ", "), js))
 
-	// Create suspense element if needed
-	if suspenseContent != "" {
-		script.WriteString("  // Create and show suspense element\n")
-		script.WriteString("  const suspenseEl = document.createElement('div');\n")
-		script.WriteString(fmt.Sprintf("  suspenseEl.innerHTML = `%s`;\n", escapeJSTemplate(suspenseContent)))
-		script.WriteString("  suspenseEl.setAttribute('data-gtml-suspense', '');\n")
-		script.WriteString("  container.appendChild(suspenseEl);\n\n")
+		result.WriteString(content[last:i])
+		result.WriteString(fmt.Sprintf("{%s#%d}", prefix, fetchExprCounter))
+		last = end + 1
+		i = end
 	}
+	result.WriteString(content[last:])
+	return result.String(), nil
+}
 
-	// Create fallback element (hidden initially) if needed
-	if fallbackContent != "" {
-		script.WriteString("  // Create fallback element (hidden initially)\n")
-		script.WriteString("  const fallbackEl = document.createElement('div');\n")
-		script.WriteString(fmt.Sprintf("  fallbackEl.innerHTML = `%s`;\n", escapeJSTemplate(fallbackContent)))
-		script.WriteString("  fallbackEl.setAttribute('data-gtml-fallback', '');\n")
-		script.WriteString("  fallbackEl.style.display = 'none';\n")
-		script.WriteString("  container.appendChild(fallbackEl);\n\n")
+// isLiteralBraces reports whether braces in a fetch template hold text instead of an
+// expression, like JSON in a data attribute. Expressions never have a ';', nested braces
+// or a ':' outside a ternary.
+func isLiteralBraces(content string) bool {
+	if strings.ContainsAny(content, ";{") {
+		return true
 	}
+	colon := findOperator(content, ":")
+	return colon != -1 && findOperator(content[:colon], "?") == -1
+}
 
-	// Store the template content for iteration
-	script.WriteString("  // Store template content\n")
-	script.WriteString(fmt.Sprintf("  const templateContent = `%s`;\n\n", escapeJSTemplate(regularContent)))
-
-	// Perform the fetch
-	script.WriteString(fmt.Sprintf("  fetch('%s', { method: '%s' })\n", fe.URL, fe.Method))
-	script.WriteString("    .then(response => {\n")
-	script.WriteString("      if (!response.ok) throw new Error('Request failed');\n")
-	script.WriteString("      return response.json();\n")
-	script.WriteString("    })\n")
-	script.WriteString(fmt.Sprintf("    .then(%s => {\n", fe.AsName))
+// compileFetchExpression compiles a template expression into JavaScript with the grammar
+// of EvaluateExpression, plus dotted paths, ! and value ternaries. Paths are looked up in
+// the scope s, so the output can only read the fetched data. It also returns the root
+// names the expression reads.
+func compileFetchExpression(expr string) (string, []string, error) {
+	var roots []string
+	js, err := compileFetchExpr(strings.TrimSpace(expr), &roots)
+	return js, roots, err
+}
 
-	// Hide suspense
-	if suspenseContent != "" {
-		script.WriteString("      // Hide suspense\n")
-		script.WriteString("      const suspense = container.querySelector('[data-gtml-suspense]');\n")
-		script.WriteString("      if (suspense) suspense.remove();\n\n")
+func compileFetchExpr(expr string, roots *[]string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return "", fmt.Errorf("missing operand")
 	}
 
-	// Process for loops and render content
-	if len(forLoops) > 0 {
-		script.WriteString("      // Process iteration\n")
-		script.WriteString("      const contentDiv = document.createElement('div');\n")
-		script.WriteString("      contentDiv.innerHTML = templateContent;\n\n")
-
-		// Add processForLoops function to handle nested iterations
-		script.WriteString("      // Process all for loops recursively\n")
-		script.WriteString("      function processForLoops(element, scope) {\n")
-		script.WriteString("        const forElements = element.querySelectorAll('[data-gtml-for]');\n")
-		script.WriteString("        forElements.forEach(template => {\n")
-		script.WriteString("          // Skip if already processed (no longer has the attribute)\n")
-		script.WriteString("          if (!template.hasAttribute('data-gtml-for')) return;\n")
-		script.WriteString("          const itemName = template.getAttribute('data-gtml-item');\n")
-		script.WriteString("          const sourcePath = template.getAttribute('data-gtml-source');\n")
-		script.WriteString("          // Get source data from scope using path\n")
-		script.WriteString("          const source = getValueByPath(scope, sourcePath);\n")
-		script.WriteString("          if (!Array.isArray(source)) {\n")
-		script.WriteString("            template.remove();\n")
-		script.WriteString("            return;\n")
-		script.WriteString("          }\n")
-		script.WriteString("          const parent = template.parentNode;\n")
-		script.WriteString("          source.forEach(item => {\n")
-		script.WriteString("            const clone = template.cloneNode(true);\n")
-		script.WriteString("            clone.removeAttribute('data-gtml-for');\n")
-		script.WriteString("            clone.removeAttribute('data-gtml-item');\n")
-		script.WriteString("            clone.removeAttribute('data-gtml-source');\n")
-		script.WriteString("            clone.style.display = '';\n")
-		script.WriteString("            // Create new scope with current item\n")
-		script.WriteString("            const newScope = Object.assign({}, scope);\n")
-		script.WriteString("            newScope[itemName] = item;\n")
-		script.WriteString("            // Replace expressions in text nodes and attributes\n")
-		script.WriteString("            clone.innerHTML = replaceExpressions(clone.innerHTML, newScope);\n")
-		script.WriteString("            // Recursively process nested for loops\n")
-		script.WriteString("            processForLoops(clone, newScope);\n")
-		script.WriteString("            parent.insertBefore(clone, template);\n")
-		script.WriteString("          });\n")
-		script.WriteString("          template.remove();\n")
-		script.WriteString("        });\n")
-		script.WriteString("      }\n\n")
-
-		// Initial scope with the fetched data
-		script.WriteString(fmt.Sprintf("      const initialScope = { '%s': %s };\n", fe.AsName, fe.AsName))
-		script.WriteString("      processForLoops(contentDiv, initialScope);\n\n")
+	binary := func(idx, width int, op string) (string, error) {
+		left, err := compileFetchExpr(expr[:idx], roots)
+		if err != nil {
+			return "", err
+		}
+		right, err := compileFetchExpr(expr[idx+width:], roots)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + op + " " + right + ")", nil
+	}
 
-		script.WriteString("      container.innerHTML = contentDiv.innerHTML;\n")
-	} else {
-		script.WriteString("      // Render content directly\n")
-		script.WriteString("      container.innerHTML = templateContent;\n")
-	}
-
-	script.WriteString("    })\n")
-	script.WriteString("    .catch(error => {\n")
-	script.WriteString("      console.error('Fetch error:', error);\n")
-
-	// Show fallback on error
-	if suspenseContent != "" {
-		script.WriteString("      // Hide suspense\n")
-		script.WriteString("      const suspense = container.querySelector('[data-gtml-suspense]');\n")
-		script.WriteString("      if (suspense) suspense.remove();\n")
-	}
-	if fallbackContent != "" {
-		script.WriteString("      // Show fallback\n")
-		script.WriteString("      const fallback = container.querySelector('[data-gtml-fallback]');\n")
-		script.WriteString("      if (fallback) fallback.style.display = '';\n")
-	}
-
-	script.WriteString("    });\n\n")
-
-	// Add helper function for getting value by path
-	script.WriteString("  // Get value from object by dot-notation path\n")
-	script.WriteString("  function getValueByPath(obj, path) {\n")
-	script.WriteString("    const parts = path.split('.');\n")
-	script.WriteString("    let value = obj[parts[0]];\n")
-	script.WriteString("    for (let i = 1; i < parts.length && value !== undefined; i++) {\n")
-	script.WriteString("      value = value[parts[i]];\n")
-	script.WriteString("    }\n")
-	script.WriteString("    return value;\n")
-	script.WriteString("  }\n\n")
-
-	// Add helper function for expression replacement
-	script.WriteString("  // Helper function to replace expressions like {user.name} with actual values\n")
-	script.WriteString("  function replaceExpressions(html, scope) {\n")
-	script.WriteString("    return html.replace(/\\{([^}]+)\\}/g, (match, expr) => {\n")
-	script.WriteString("      expr = expr.trim();\n")
-	script.WriteString("      // Try to resolve the expression from scope\n")
-	script.WriteString("      const parts = expr.split('.');\n")
-	script.WriteString("      let value = scope[parts[0]];\n")
-	script.WriteString("      for (let i = 1; i < parts.length && value !== undefined; i++) {\n")
-	script.WriteString("        value = value[parts[i]];\n")
-	script.WriteString("      }\n")
-	script.WriteString("      return value !== undefined ? value : match;\n")
-	script.WriteString("    });\n")
-	script.WriteString("  }\n")
-
-	script.WriteString("})();\n</script>\n")
-
-	return script.String()
-}
-
-// escapeJSTemplate escapes a string for use in JavaScript template literals
-func escapeJSTemplate(s string) string {
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "`", "\\`")
-	s = strings.ReplaceAll(s, "${", "\\${")
-	return s
-}
-
-type CompileOptions struct {
-	ComponentsDir string
-	RoutesDir     string
-	DistDir       string
-	StaticDir     string
-}
-
-func CompileProject(basePath string, opts CompileOptions) error {
-	state := &GlobalState{
-		Components: make(map[string]*Component),
-	}
-
-	compDir := filepath.Join(basePath, opts.ComponentsDir)
-	if _, err := os.Stat(compDir); os.IsNotExist(err) {
-		return fmt.Errorf("missing required directory: %s", compDir)
-	}
-
-	err := filepath.Walk(compDir, func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if q := findOperator(expr, "?"); q != -1 {
+		colon := findTernaryColon(expr, q+1)
+		if colon == -1 {
+			return "", fmt.Errorf("ternary is missing ':'")
 		}
-		if info.IsDir() || filepath.Ext(path) != ".html" {
-			return nil
+		cond, err := compileFetchExpr(expr[:q], roots)
+		if err != nil {
+			return "", err
 		}
-
-		name := strings.TrimSuffix(filepath.Base(path), ".html")
-		if !IsPascalCase(name) {
-			return fmt.Errorf("component '%s' must be PascalCase", path)
+		truthy, err := compileFetchExpr(expr[q+1:colon], roots)
+		if err != nil {
+			return "", err
 		}
-		if _, exists := state.Components[name]; exists {
-			return fmt.Errorf("duplicate component name found: %s", name)
+		falsy, err := compileFetchExpr(expr[colon+1:], roots)
+		if err != nil {
+			return "", err
 		}
+		return "(" + cond + " ? " + truthy + " : " + falsy + ")", nil
+	}
 
-		contentBytes, err := os.ReadFile(path)
-		if err != nil {
-			return err
+	switch expr {
+	case "true", "false", "null":
+		return expr, nil
+	}
+	if quote := expr[0]; (quote == '\'' || quote == '"') && strings.IndexByte(expr[1:], quote) == len(expr)-2 {
+		encoded, _ := json.Marshal(expr[1 : len(expr)-1])
+		return string(encoded), nil
+	}
+	if f, err := strconv.ParseFloat(expr, 64); err == nil {
+		// Go also parses Inf, NaN and hex floats, which aren't JavaScript literals
+		switch {
+		case reJSNumber.MatchString(expr):
+			return expr, nil
+		case math.IsInf(f, 1):
+			return "Infinity", nil
+		case math.IsInf(f, -1):
+			return "-Infinity", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	}
+
+	if idx := findOperator(expr, "||"); idx != -1 {
+		return binary(idx, 2, "||")
+	}
+	if idx := findOperator(expr, "&&"); idx != -1 {
+		return binary(idx, 2, "&&")
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if idx := findOperator(expr, op); idx != -1 {
+			jsOp := op
+			if op == "==" || op == "!=" {
+				jsOp += "="
+			}
+			return binary(idx, len(op), jsOp)
 		}
-		content := string(contentBytes)
+	}
+	if idx := findOperatorRTL(expr, "+", "-"); idx != -1 {
+		return binary(idx, 1, string(expr[idx]))
+	}
+	if idx := findOperatorRTL(expr, "*", "/", "%"); idx != -1 {
+		return binary(idx, 1, string(expr[idx]))
+	}
 
-		scopeID := "data-" + strings.ToLower(name)
-		template, css, err := ProcessComponentStyles(content, scopeID)
+	if expr[0] == '!' || expr[0] == '-' {
+		operand, err := compileFetchExpr(expr[1:], roots)
 		if err != nil {
-			return err
+			return "", err
 		}
-
-		propDefs, template, err := ParsePropsAttribute(template)
+		return expr[:1] + operand, nil
+	}
+	if expr[0] == '(' && findClosingParen(expr, 0) == len(expr)-1 {
+		inner, err := compileFetchExpr(expr[1:len(expr)-1], roots)
 		if err != nil {
-			return fmt.Errorf("error parsing props in %s: %v", path, err)
+			return "", err
 		}
+		return "(" + inner + ")", nil
+	}
 
-		if !HasSingleRoot(template) {
-			return fmt.Errorf("component '%s' must have a single root element", name)
+	if reFetchPath.MatchString(expr) {
+		root := strings.SplitN(expr, ".", 2)[0]
+		if !slices.Contains(*roots, root) {
+			*roots = append(*roots, root)
 		}
+		return fmt.Sprintf("getValueByPath(s, '%s')", expr), nil
+	}
 
-		template = InjectScopeID(template, scopeID)
+	return "", fmt.Errorf("unsupported syntax %q", expr)
+}
 
-		state.Components[name] = &Component{
-			Name:        name,
-			RawContent:  content,
-			Template:    template,
-			ScopedStyle: css,
-			ScopeID:     scopeID,
-			Path:        path,
-			PropDefs:    propDefs,
+// findTernaryColon finds the ':' that closes the ternary whose '?' ends before start
+func findTernaryColon(expr string, start int) int {
+	depth, nested := 0, 0
+	var quote byte
+	for i := start; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c == '?':
+			nested++
+		case depth == 0 && c == ':':
+			if nested == 0 {
+				return i
+			}
+			nested--
 		}
+	}
+	return -1
+}
 
-		if css != "" {
-			state.CSSOutput.WriteString("/* " + name + " */\n")
-			state.CSSOutput.WriteString(css + "\n")
+// findClosingParen finds the ')' matching the '(' at start, skipping quoted strings
+func findClosingParen(expr string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
 		}
+	}
+	return -1
+}
 
-		return nil
-	})
-
+// evalStaticExpression evaluates a fetch template expression at compile time with the
+// same results as the compiled javascript. Missing and null values are empty. It reports
+// false when the expression reads a name that isn't in scope.
+func evalStaticExpression(expr string, scope map[string]any) (any, bool, error) {
+	_, roots, err := compileFetchExpression(expr)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
-
-	routesDir := filepath.Join(basePath, opts.RoutesDir)
-	if _, err := os.Stat(routesDir); os.IsNotExist(err) {
-		return fmt.Errorf("missing required directory: %s", routesDir)
+	for _, root := range roots {
+		if _, ok := scope[root]; !ok {
+			return nil, false, nil
+		}
+	}
+	value, err := evalFetchExpr(expr, scope)
+	if value == nil {
+		value = ""
 	}
+	return value, true, err
+}
 
-	distDir := filepath.Join(basePath, opts.DistDir)
+// evalFetchExpr mirrors compileFetchExpr, evaluating with javascript semantics instead
+// of generating code
+func evalFetchExpr(expr string, scope map[string]any) (any, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("missing operand")
+	}
 
-	err = filepath.Walk(routesDir, func(path string, info fs.FileInfo, err error) error {
+	operands := func(idx, width int) (any, any, error) {
+		left, err := evalFetchExpr(expr[:idx], scope)
 		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		if filepath.Ext(path) != ".html" {
-			return nil
+			return nil, nil, err
 		}
+		right, err := evalFetchExpr(expr[idx+width:], scope)
+		return left, right, err
+	}
 
-		relPath, _ := filepath.Rel(routesDir, path)
-		fileName := strings.TrimSuffix(filepath.Base(path), ".html")
-		if fileName != "index" && !IsKebabCase(fileName) {
-			return fmt.Errorf("route '%s' must be kebab-case", path)
+	if q := findOperator(expr, "?"); q != -1 {
+		colon := findTernaryColon(expr, q+1)
+		if colon == -1 {
+			return nil, fmt.Errorf("ternary is missing ':'")
 		}
-
-		contentBytes, err := os.ReadFile(path)
+		cond, err := evalFetchExpr(expr[:q], scope)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		compiledHTML, err := CompileHTML(string(contentBytes), state, map[string]Value{}, true)
-		if err != nil {
-			return fmt.Errorf("error compiling %s: %v", path, err)
+		if jsTruthy(cond) {
+			return evalFetchExpr(expr[q+1:colon], scope)
 		}
+		return evalFetchExpr(expr[colon+1:], scope)
+	}
 
-		// Inject inline CSS into the head for reliable styling
-		cssContent := state.CSSOutput.String()
-		if cssContent != "" && strings.Contains(compiledHTML, "</head>") {
-			inlineStyle := fmt.Sprintf("<style>\n%s</style>\n</head>", cssContent)
-			compiledHTML = strings.Replace(compiledHTML, "</head>", inlineStyle, 1)
-		}
+	switch expr {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if quote := expr[0]; (quote == '\'' || quote == '"') && strings.IndexByte(expr[1:], quote) == len(expr)-2 {
+		return expr[1 : len(expr)-1], nil
+	}
+	if f, err := strconv.ParseFloat(expr, 64); err == nil {
+		return f, nil
+	}
 
-		outPath := filepath.Join(distDir, relPath)
-		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
-			return err
+	if idx := findOperator(expr, "||"); idx != -1 {
+		left, right, err := operands(idx, 2)
+		if jsTruthy(left) {
+			return left, err
 		}
-
-		return os.WriteFile(outPath, []byte(compiledHTML), 0644)
-	})
-
-	if err != nil {
-		return err
+		return right, err
 	}
-
-	staticDistDir := filepath.Join(distDir, opts.StaticDir)
-	if err := os.MkdirAll(staticDistDir, 0755); err != nil {
-		return err
+	if idx := findOperator(expr, "&&"); idx != -1 {
+		left, right, err := operands(idx, 2)
+		if !jsTruthy(left) {
+			return left, err
+		}
+		return right, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if idx := findOperator(expr, op); idx != -1 {
+			left, right, err := operands(idx, len(op))
+			switch op {
+			case "==":
+				return jsStrictEqual(left, right), err
+			case "!=":
+				return !jsStrictEqual(left, right), err
+			}
+			return jsCompare(op, left, right), err
+		}
+	}
+	if idx := findOperatorRTL(expr, "+", "-"); idx != -1 {
+		left, right, err := operands(idx, 1)
+		if expr[idx] == '-' {
+			return toJSNumber(left) - toJSNumber(right), err
+		}
+		if isJSStringLike(left) || isJSStringLike(right) {
+			return toJSString(left) + toJSString(right), err
+		}
+		return toJSNumber(left) + toJSNumber(right), err
+	}
+	if idx := findOperatorRTL(expr, "*", "/", "%"); idx != -1 {
+		left, right, err := operands(idx, 1)
+		a, b := toJSNumber(left), toJSNumber(right)
+		switch expr[idx] {
+		case '*':
+			return a * b, err
+		case '/':
+			return a / b, err
+		}
+		return math.Mod(a, b), err
 	}
 
-	// Copy static files first
-	srcStatic := filepath.Join(basePath, opts.StaticDir)
-	if _, err := os.Stat(srcStatic); err == nil {
-		copyDir(srcStatic, staticDistDir)
+	if expr[0] == '!' || expr[0] == '-' {
+		operand, err := evalFetchExpr(expr[1:], scope)
+		if expr[0] == '!' {
+			return !jsTruthy(operand), err
+		}
+		return -toJSNumber(operand), err
+	}
+	if expr[0] == '(' && findClosingParen(expr, 0) == len(expr)-1 {
+		return evalFetchExpr(expr[1:len(expr)-1], scope)
 	}
 
-	// Write generated CSS last so it overwrites any placeholder from source static
-	cssFile := filepath.Join(staticDistDir, "styles.css")
-	if err := os.WriteFile(cssFile, []byte(state.CSSOutput.String()), 0644); err != nil {
-		return err
+	if reFetchPath.MatchString(expr) {
+		value, _ := fetchPathValue(scope, expr)
+		return value, nil
 	}
 
-	return nil
+	return nil, fmt.Errorf("unsupported syntax %q", expr)
 }
 
-func copyDir(src, dst string) error {
-	return filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		relPath, _ := filepath.Rel(src, path)
-		dstPath := filepath.Join(dst, relPath)
-
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, info.Mode())
+// fetchPathValue looks up a dotted path in JSON data like getValueByPath. It reports
+// false when the path resolves to nothing.
+func fetchPathValue(scope map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	value, ok := scope[parts[0]]
+	for _, part := range parts[1:] {
+		if !ok {
+			break
 		}
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
+		switch v := value.(type) {
+		case map[string]any:
+			value, ok = v[part]
+		case []any:
+			if part == "length" {
+				value = float64(len(v))
+			} else if i, err := strconv.Atoi(part); err == nil && i >= 0 && i < len(v) {
+				value = v[i]
+			} else {
+				value, ok = nil, false
+			}
+		case string:
+			value, ok = float64(len([]rune(v))), part == "length"
+		default:
+			value, ok = nil, false
 		}
-		return os.WriteFile(dstPath, data, info.Mode())
-	})
+	}
+	return value, ok
 }
 
-func WatchProject(basePath string, opts CompileOptions) {
-	fmt.Printf("Watching %s for changes...\n", basePath)
-	if err := CompileProject(basePath, opts); err != nil {
-		fmt.Printf("Compile Error: %v\n", err)
-	} else {
-		fmt.Println("Built successfully.")
+// jsTruthy reports whether a JSON value is truthy in javascript
+func jsTruthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
 	}
+	return true
+}
 
-	lastMod := time.Now()
-
-	for {
-		time.Sleep(1 * time.Second)
-		needsCompile := false
+// toJSNumber converts a JSON value to a number like javascript's Number()
+func toJSNumber(v any) float64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return math.NaN()
+}
 
-		filepath.Walk(basePath, func(path string, info fs.FileInfo, err error) error {
-			if err != nil {
-				return nil
+// toJSString converts a JSON value to a string like javascript's String()
+func toJSString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v != 0 && (math.Abs(v) < 1e-6 || math.Abs(v) >= 1e21):
+			return strconv.FormatFloat(v, 'e', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			if item != nil {
+				parts[i] = toJSString(item)
 			}
-			if info.IsDir() {
-				if strings.Contains(path, opts.DistDir) {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			if info.ModTime().After(lastMod) {
-				needsCompile = true
-				return errors.New("change found")
-			}
-			return nil
-		})
+		}
+		return strings.Join(parts, ",")
+	}
+	return "[object Object]"
+}
 
-		if needsCompile {
-			fmt.Println("Change detected. Compiling...")
-			if err := CompileProject(basePath, opts); err != nil {
-				fmt.Printf("Compile Error: %v\n", err)
-			} else {
-				fmt.Println("Built successfully.")
+// isJSStringLike reports whether + concatenates with v instead of adding it
+func isJSStringLike(v any) bool {
+	switch v.(type) {
+	case string, []any, map[string]any:
+		return true
+	}
+	return false
+}
+
+// jsStrictEqual compares like ===. Lists and objects are never equal as they're copies.
+func jsStrictEqual(a, b any) bool {
+	switch a.(type) {
+	case nil, bool, string, float64:
+		return a == b
+	}
+	return false
+}
+
+// jsCompare compares like javascript's relational operators
+func jsCompare(op string, left, right any) bool {
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			c := strings.Compare(l, r)
+			switch op {
+			case "<":
+				return c < 0
+			case ">":
+				return c > 0
+			case "<=":
+				return c <= 0
 			}
-			lastMod = time.Now()
+			return c >= 0
 		}
 	}
+	a, b := toJSNumber(left), toJSNumber(right)
+	switch op {
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "<=":
+		return a <= b
+	}
+	return a >= b
+}
+
+// ParseForAttribute parses a for attribute value like "user in users", "color in user.colors"
+// or "user, i in users"
+func ParseForAttribute(value string) (ForLoop, error) {
+	parts := strings.Split(strings.TrimSpace(value), " in ")
+	if len(parts) != 2 {
+		return ForLoop{}, fmt.Errorf("invalid for attribute format: expected 'item in items', got '%s'", value)
+	}
+
+	itemName := strings.TrimSpace(parts[0])
+	sourcePath := strings.TrimSpace(parts[1])
+
+	indexName := ""
+	if item, index, ok := strings.Cut(itemName, ","); ok {
+		itemName = strings.TrimSpace(item)
+		indexName = strings.TrimSpace(index)
+		if !reIdentifier.MatchString(itemName) || !reIdentifier.MatchString(indexName) {
+			return ForLoop{}, fmt.Errorf("invalid for attribute format: expected 'item, index in items', got '%s'", value)
+		}
+	}
+
+	// Get the base source name (first part before any dots)
+	sourceName := sourcePath
+	if idx := strings.Index(sourcePath, "."); idx != -1 {
+		sourceName = sourcePath[:idx]
+	}
+
+	return ForLoop{
+		ItemName:   itemName,
+		IndexName:  indexName,
+		SourceName: sourceName,
+		SourcePath: sourcePath,
+	}, nil
+}
+
+// generateFetchScript generates the JavaScript code for a fetch element
+func generateFetchScript(fe FetchElement, req fetchRequest, children fetchChildren, regularContent, expressions string, forLoops []ForLoop, shared bool) string {
+	suspenseContent := children.Suspense
+	var script strings.Builder
+	script.WriteString("\n<script>\n(function() {\n")
+
+	// Get references to the container
+	script.WriteString(fmt.Sprintf("  const container = document.getElementById('%s');\n", fe.ID))
+	script.WriteString("  if (!container) return;\n")
+	if req.ReadsSignals {
+		// Signals belong to the closest component instance, or the page
+		script.WriteString("  const instance = container.closest('[data-gtml-instance]');\n")
+		script.WriteString("  const _s = gtmlScope(instance ? instance.getAttribute('data-gtml-instance') : '');\n")
+	}
+	script.WriteString("\n")
+
+	// Create suspense element if needed
+	if suspenseContent != "" {
+		script.WriteString("  // Create and show suspense element\n")
+		script.WriteString("  const suspenseEl = document.createElement('div');\n")
+		script.WriteString(fmt.Sprintf("  suspenseEl.innerHTML = `%s`;\n", escapeJSTemplate(suspenseContent)))
+		script.WriteString("  suspenseEl.setAttribute('data-gtml-suspense', '');\n")
+		script.WriteString("  container.appendChild(suspenseEl);\n\n")
+	}
+
+	// Create fallback elements (hidden initially) if needed, one is chosen by response status on error
+	if len(children.Fallbacks) > 0 {
+		script.WriteString("  // Create fallback elements (hidden initially)\n")
+		script.WriteString("  const fallbacks = [\n")
+		for _, fallback := range children.Fallbacks {
+			script.WriteString(fmt.Sprintf("    { status: '%s', template: `%s` },\n", fallback.Status, escapeJSTemplate(fallback.Content)))
+		}
+		script.WriteString("  ];\n")
+		script.WriteString("  fallbacks.forEach(fallback => {\n")
+		script.WriteString("    fallback.el = document.createElement('div');\n")
+		script.WriteString("    fallback.el.setAttribute('data-gtml-fallback', fallback.status);\n")
+		script.WriteString("    fallback.el.style.display = 'none';\n")
+		script.WriteString("    container.appendChild(fallback.el);\n")
+		script.WriteString("  });\n\n")
+	}
+
+	// Store the template content for iteration
+	script.WriteString("  // Store template content\n")
+	script.WriteString(fmt.Sprintf("  const templateContent = `%s`;\n\n", escapeJSTemplate(regularContent)))
+	if children.Empty != "" {
+		script.WriteString(fmt.Sprintf("  const emptyContent = `%s`;\n\n", escapeJSTemplate(children.Empty)))
+	}
+	if expressions != "" {
+		script.WriteString("  // Compiled template expressions\n")
+		script.WriteString("  gtmlFetchExpressions({\n" + expressions + "  });\n\n")
+	}
+
+	// Render fetched data
+	script.WriteString(fmt.Sprintf("  function render(%s) {\n", fe.AsName))
+
+	// Hide suspense
+	if suspenseContent != "" {
+		script.WriteString("    // Hide suspense\n")
+		script.WriteString("    const suspense = container.querySelector('[data-gtml-suspense]');\n")
+		script.WriteString("    if (suspense) suspense.remove();\n\n")
+	}
+
+	// Show the empty child for null or an empty array
+	if children.Empty != "" {
+		script.WriteString(fmt.Sprintf("    if (%s == null || (Array.isArray(%s) && %s.length === 0)) {\n", fe.AsName, fe.AsName, fe.AsName))
+		script.WriteString("      container.innerHTML = emptyContent;\n")
+		script.WriteString("      return;\n")
+		script.WriteString("    }\n\n")
+	}
+
+	// Process for loops and render content
+	if len(forLoops) > 0 {
+		// Initial scope with the fetched data
+		script.WriteString(fmt.Sprintf("    const initialScope = { '%s': %s };\n\n", fe.AsName, fe.AsName))
+
+		script.WriteString("    // Process iteration\n")
+		script.WriteString("    const content = gtmlFillTemplate(templateContent, initialScope);\n")
+		script.WriteString("    processForLoops(content, initialScope);\n\n")
+
+		if strings.Contains(regularContent, "data-gtml-key=") {
+			script.WriteString("    gtmlReconcile(container, content);\n")
+		} else {
+			script.WriteString("    container.replaceChildren(content);\n")
+		}
+	} else {
+		script.WriteString("    // Render content directly\n")
+		script.WriteString(fmt.Sprintf("    container.innerHTML = replaceExpressions(templateContent, { '%s': %s });\n", fe.AsName, fe.AsName))
+	}
+	script.WriteString("  }\n\n")
+
+	script.WriteString("  function fail(error) {\n")
+	script.WriteString("    console.error('Fetch error:', error);\n")
+
+	// Show fallback on error
+	if suspenseContent != "" {
+		script.WriteString("    // Hide suspense\n")
+		script.WriteString("    const suspense = container.querySelector('[data-gtml-suspense]');\n")
+		script.WriteString("    if (suspense) suspense.remove();\n")
+	}
+	if len(children.Fallbacks) > 0 {
+		script.WriteString("    // Show the fallback for the status, replacing content rendered by an earlier request\n")
+		script.WriteString("    const status = error.cause ? error.cause.status : 0;\n")
+		script.WriteString("    const match = gtmlFallbackFor(fallbacks, status);\n")
+		script.WriteString("    if (!match) return;\n")
+		script.WriteString("    const fallback = match.el;\n")
+		script.WriteString("    fallback.innerHTML = replaceExpressions(match.template, { error: { message: error.message, status }, status });\n")
+		script.WriteString("    container.replaceChildren(fallback);\n")
+		script.WriteString("    fallback.style.display = '';\n")
+	}
+	script.WriteString("  }\n\n")
+
+	// Perform the fetch. A refetch aborts the request in flight, cached requests are
+	// shared with other elements so they are ignored instead.
+	if req.Cache {
+		script.WriteString("  let current = null;\n\n")
+		script.WriteString("  function load(revalidate) {\n")
+		script.WriteString("    const request = current = {};\n")
+		maxAge := "0"
+		if req.MaxAge > 0 {
+			maxAge = fmt.Sprintf("revalidate ? 0 : %d", req.MaxAge.Milliseconds())
+		}
+		script.WriteString(fmt.Sprintf("    gtmlCachedFetch(%s, { method: '%s'%s }, %s, %s => {\n", req.URL, fe.Method, req.Options, maxAge, fe.AsName))
+		script.WriteString(fmt.Sprintf("      if (request === current) render(%s);\n", fe.AsName))
+		script.WriteString("    }).catch(error => {\n")
+		script.WriteString("      if (request === current) fail(error);\n")
+		script.WriteString("    });\n")
+		script.WriteString("  }\n\n")
+	} else {
+		script.WriteString("  let controller = null;\n\n")
+		script.WriteString("  function load() {\n")
+		script.WriteString("    if (controller) controller.abort();\n")
+		script.WriteString("    controller = new AbortController();\n")
+		script.WriteString(fmt.Sprintf("    fetch(%s, { method: '%s'%s, signal: controller.signal })\n", req.URL, fe.Method, req.Options))
+		script.WriteString("      .then(response => {\n")
+		script.WriteString("        if (!response.ok) throw new Error('Request failed with status ' + response.status, { cause: response });\n")
+		script.WriteString("        return response.json();\n")
+		script.WriteString("      })\n")
+		script.WriteString(fmt.Sprintf("      .then(%s => render(%s))\n", fe.AsName, fe.AsName))
+		script.WriteString("      .catch(error => {\n")
+		script.WriteString("        if (error.name === 'AbortError') return;\n")
+		script.WriteString("        fail(error);\n")
+		script.WriteString("      });\n")
+		script.WriteString("  }\n\n")
+	}
+
+	if len(req.Watch) > 0 {
+		// The effect only tracks the url's signals, signals read by the request itself don't refetch
+		script.WriteString("  // Refetch when a signal in the url changes\n")
+		script.WriteString("  gtmlEffect(() => {\n")
+		for _, name := range req.Watch {
+			script.WriteString(fmt.Sprintf("    _s.get('%s');\n", name))
+		}
+		script.WriteString("    gtmlUntracked(load);\n")
+		script.WriteString("  });\n\n")
+	} else {
+		script.WriteString("  load();\n\n")
+	}
+
+	if fe.AsName != "" {
+		script.WriteString(fmt.Sprintf("  _gtmlFetches().push({ name: '%s', container, load: () => load(true) });\n", fe.AsName))
+	}
+	if req.Interval > 0 {
+		script.WriteString(fmt.Sprintf("  setInterval(() => { if (!document.hidden) load(true); }, %d);\n", req.Interval.Milliseconds()))
+	}
+	script.WriteString("\n")
+
+	// Helpers live in the shared runtime when there is one
+	if !shared {
+		for _, line := range strings.Split(strings.TrimSpace(FetchLibrary), "\n") {
+			if line == "" {
+				script.WriteString("\n")
+				continue
+			}
+			script.WriteString("  " + line + "\n")
+		}
+	}
+
+	script.WriteString("})();\n</script>\n")
+
+	return script.String()
+}
+
+// fetchRequest is the compiled form of a fetch element's request
+type fetchRequest struct {
+	URL          string   // JavaScript expression for the url
+	Options      string   // Entries that follow method in the fetch() options object
+	Watch        []string // Signals in the url, the element refetches when they change
+	ReadsSignals bool     // Whether the request needs the signal scope
+	Interval     time.Duration
+	Cache        bool
+	MaxAge       time.Duration // How long cached data is used without revalidating
+}
+
+// compileFetchRequest compiles the url and the fetch-headers, fetch-body,
+// fetch-credentials and fetch-mode attributes of a fetch element
+func compileFetchRequest(fe FetchElement) (fetchRequest, error) {
+	req := fetchRequest{URL: "'" + fe.URL + "'"}
+	if reFetchURLRead.MatchString(fe.URL) {
+		seen := map[string]bool{}
+		req.URL = "`" + reFetchURLRead.ReplaceAllStringFunc(escapeJSTemplate(fe.URL), func(read string) string {
+			name := read[2 : len(read)-1]
+			if !seen[name] {
+				seen[name] = true
+				req.Watch = append(req.Watch, name)
+			}
+			return fmt.Sprintf("${encodeURIComponent(_s.get('%s') ?? '')}", name)
+		}) + "`"
+	}
+
+	options, readsSignals, err := fetchRequestOptions(fe)
+	if err != nil {
+		return req, err
+	}
+	req.Options = options
+	req.ReadsSignals = readsSignals || len(req.Watch) > 0
+
+	if fe.Interval != "" {
+		interval, err := time.ParseDuration(fe.Interval)
+		if err != nil || interval <= 0 {
+			return req, fmt.Errorf("invalid fetch-interval %q: expected a duration like '30s'", fe.Interval)
+		}
+		req.Interval = interval
+	}
+
+	if fe.Cache {
+		if fe.Method != "GET" {
+			return req, fmt.Errorf("fetch-cache only applies to GET requests, got %s", fe.Method)
+		}
+		req.Cache = true
+		if fe.CacheMaxAge != "" {
+			maxAge, err := time.ParseDuration(fe.CacheMaxAge)
+			if err != nil || maxAge < 0 {
+				return req, fmt.Errorf("invalid fetch-cache %q: expected a duration like '60s'", fe.CacheMaxAge)
+			}
+			req.MaxAge = maxAge
+		}
+	}
+	return req, nil
+}
+
+// fetchRequestOptions compiles fetch-headers, fetch-body, fetch-credentials and fetch-mode
+// into the entries that follow method in the fetch() options object
+func fetchRequestOptions(fe FetchElement) (string, bool, error) {
+	var options strings.Builder
+	readsSignals := false
+
+	// Headers are separated by ';'. A segment without a colon, such as charset=utf-8,
+	// continues the previous header's value.
+	var names, values []string
+	for _, segment := range strings.Split(fe.Headers, ";") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(segment, ":")
+		if !ok && len(values) > 0 {
+			values[len(values)-1] += "; " + segment
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return "", false, fmt.Errorf("invalid fetch-headers entry %q: expected 'Name: value'", segment)
+		}
+		names = append(names, name)
+		values = append(values, strings.TrimSpace(value))
+	}
+
+	var headers []string
+	hasContentType := false
+	for i, name := range names {
+		if strings.EqualFold(name, "Content-Type") {
+			hasContentType = true
+		}
+		valueJS, signals := fetchValueJS(values[i], false)
+		readsSignals = readsSignals || signals
+		headers = append(headers, jsValue(Value{Type: PropTypeString, StrVal: name})+": "+valueJS)
+	}
+
+	body := ""
+	if trimmed := strings.TrimSpace(fe.Body); trimmed != "" {
+		if fe.Method == "GET" || fe.Method == "HEAD" {
+			return "", false, fmt.Errorf("%s requests cannot have a fetch-body", fe.Method)
+		}
+		if m := reFetchSignal.FindStringSubmatch(trimmed); m != nil && m[0] == trimmed {
+			body = fmt.Sprintf("_s.get('%s')", m[1])
+			readsSignals = true
+		} else {
+			var fields []string
+			for _, field := range splitFetchBody(trimmed) {
+				key, value, ok := strings.Cut(field, ":")
+				key = strings.TrimSpace(key)
+				if !ok || key == "" {
+					return "", false, fmt.Errorf("invalid fetch-body field %q: expected 'key: value'", strings.TrimSpace(field))
+				}
+				valueJS, signals := fetchValueJS(strings.TrimSpace(value), true)
+				readsSignals = readsSignals || signals
+				fields = append(fields, jsValue(Value{Type: PropTypeString, StrVal: key})+": "+valueJS)
+			}
+			body = "{ " + strings.Join(fields, ", ") + " }"
+		}
+		if !hasContentType {
+			headers = append([]string{`"Content-Type": "application/json"`}, headers...)
+		}
+	}
+
+	if len(headers) > 0 {
+		options.WriteString(", headers: { " + strings.Join(headers, ", ") + " }")
+	}
+	if body != "" {
+		options.WriteString(", body: JSON.stringify(" + body + ")")
+	}
+
+	if fe.Credentials != "" {
+		switch fe.Credentials {
+		case "omit", "same-origin", "include":
+			options.WriteString(fmt.Sprintf(", credentials: '%s'", fe.Credentials))
+		default:
+			return "", false, fmt.Errorf("invalid fetch-credentials %q: expected omit, same-origin or include", fe.Credentials)
+		}
+	}
+	if fe.Mode != "" {
+		switch fe.Mode {
+		case "cors", "no-cors", "same-origin":
+			options.WriteString(fmt.Sprintf(", mode: '%s'", fe.Mode))
+		default:
+			return "", false, fmt.Errorf("invalid fetch-mode %q: expected cors, no-cors or same-origin", fe.Mode)
+		}
+	}
+
+	return options.String(), readsSignals, nil
+}
+
+// fetchValueJS compiles a header or body value. $name reads a signal at request time,
+// and typed body values that are JSON literals keep their type; anything else is a string.
+func fetchValueJS(value string, typed bool) (string, bool) {
+	if m := reFetchSignal.FindStringSubmatch(value); m != nil && m[0] == value {
+		return fmt.Sprintf("_s.get('%s')", m[1]), true
+	}
+	if typed && json.Valid([]byte(value)) {
+		return value, false
+	}
+	if !reFetchSignal.MatchString(value) {
+		return jsValue(Value{Type: PropTypeString, StrVal: value}), false
+	}
+	return "`" + reFetchSignal.ReplaceAllStringFunc(escapeJSTemplate(value), func(ref string) string {
+		return fmt.Sprintf("${_s.get('%s')}", ref[1:])
+	}) + "`", true
+}
+
+// splitFetchBody splits fetch-body fields on commas outside double-quoted strings
+func splitFetchBody(body string) []string {
+	var fields []string
+	inString := false
+	start := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			inString = !inString
+		case ',':
+			if !inString {
+				fields = append(fields, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, body[start:])
+}
+
+// formCounter is used to generate unique IDs for enhanced forms
+var formCounter int
+
+// formChildren are the templates of an enhanced form's success and fallback children
+type formChildren struct {
+	Success     string
+	Fallbacks   []fetchFallback
+	Expressions string
+	HasSuspense bool
+}
+
+// isEnhancedForm reports whether a form's attributes make it submit through fetch
+func isEnhancedForm(attrsStr string) bool {
+	return reFormAction.MatchString(attrsStr) || reAsAttr.MatchString(attrsStr)
+}
+
+// findFormElements finds every enhanced form, a form with an action like 'POST /api/login'
+// or an as attribute
+func findFormElements(html string) ([]FetchElement, error) {
+	var elements []FetchElement
+	offset := 0
+	for {
+		idx := strings.Index(html[offset:], "<form")
+		if idx == -1 {
+			break
+		}
+		startIdx, endIdx, tagName, _, attrsStr, innerContent := findElementAt(html, offset+idx)
+		if startIdx == -1 || tagName != "form" {
+			offset += idx + 1
+			continue
+		}
+		offset = endIdx
+		if !isEnhancedForm(attrsStr) {
+			continue
+		}
+
+		m := reFormAction.FindStringSubmatch(attrsStr)
+		if m == nil {
+			return nil, fmt.Errorf("form with an as attribute needs an action like 'POST /api/login'")
+		}
+		fe := FetchElement{
+			Method:       strings.ToUpper(m[1]),
+			URL:          strings.TrimSpace(m[2]),
+			AsName:       "result",
+			StartIdx:     startIdx,
+			EndIdx:       endIdx,
+			TagName:      tagName,
+			InnerContent: innerContent,
+			FullElement:  html[startIdx:endIdx],
+		}
+		if asMatch := reAsAttr.FindStringSubmatch(attrsStr); asMatch != nil {
+			fe.AsName = asMatch[1]
+		}
+		readFetchOptions(&fe, attrsStr)
+		elements = append(elements, fe)
+	}
+	return elements, nil
+}
+
+// protectFormTemplates protects the success and fallback templates of enhanced forms,
+// and signal reads in their action, from compile time evaluation. The form's fields are
+// left alone so they can use props.
+func protectFormTemplates(html string) string {
+	result := reFormAction.ReplaceAllStringFunc(html, func(attr string) string {
+		return reFetchURLRead.ReplaceAllString(attr, fetchExprMarker+"OPEN"+fetchExprMarker+"$$${1}"+fetchExprMarker+"CLOSE"+fetchExprMarker)
+	})
+	offset := 0
+	for {
+		idx := strings.Index(result[offset:], "<form")
+		if idx == -1 {
+			break
+		}
+		startIdx, endIdx, tagName, _, attrsStr, innerContent := findElementAt(result, offset+idx)
+		if startIdx == -1 || tagName != "form" {
+			offset += idx + 1
+			continue
+		}
+		if !isEnhancedForm(attrsStr) {
+			offset = endIdx
+			continue
+		}
+
+		protected := innerContent
+		for _, attr := range []string{"success", "fallback"} {
+			childOffset := 0
+			for {
+				childStart := findElementWithAttr(protected[childOffset:], attr)
+				if childStart == -1 {
+					break
+				}
+				childStart += childOffset
+				start, end, _, _, _, inner := findElementAt(protected, childStart)
+				if start == -1 {
+					break
+				}
+				innerStart := strings.Index(protected[start:], ">") + start + 1
+				protectedInner := protectExpressionsInContent(inner)
+				protected = protected[:innerStart] + protectedInner + protected[innerStart+len(inner):]
+				childOffset = end - len(inner) + len(protectedInner)
+			}
+		}
+
+		innerStart := endIdx - len("</form>") - len(innerContent)
+		result = result[:innerStart] + protected + result[innerStart+len(innerContent):]
+		offset = innerStart + len(protected)
+	}
+	return result
+}
+
+// ProcessFormElements processes HTML to find enhanced forms and generate JavaScript
+func ProcessFormElements(html string) (string, error) {
+	return processFormElements(html, nil)
+}
+
+// processFormElements turns forms with an action like 'POST /api/login' into forms that
+// submit through fetch. Scripts are placed like fetch scripts.
+func processFormElements(html string, state *GlobalState) (string, error) {
+	forms, err := findFormElements(html)
+	if err != nil {
+		return "", err
+	}
+
+	shared := state != nil && state.SharedRuntime
+	var sharedScripts []string
+	result := html
+
+	for i := len(forms) - 1; i >= 0; i-- {
+		fe := forms[i]
+		formCounter++
+		fe.ID = fmt.Sprintf("gtml-form-%d", formCounter)
+
+		processedElement, script, readsSignals, err := processSingleFormElement(fe, shared)
+		if err != nil {
+			return "", fmt.Errorf("error processing form: %v", err)
+		}
+
+		if shared || (state != nil && readsSignals) {
+			sharedScripts = append([]string{script}, sharedScripts...)
+			script = ""
+		}
+
+		result = result[:fe.StartIdx] + processedElement + script + result[fe.EndIdx:]
+	}
+
+	for _, script := range sharedScripts {
+		state.InteractivityJS.WriteString(script)
+	}
+
+	return result, nil
+}
+
+// processSingleFormElement compiles an enhanced form's request and its children, and
+// returns the form's HTML, its script and whether the request reads signals
+func processSingleFormElement(fe FetchElement, shared bool) (string, string, bool, error) {
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"body", fe.Body != ""},
+		{"interval", fe.Interval != ""},
+		{"cache", fe.Cache},
+	} {
+		if option.set {
+			return "", "", false, fmt.Errorf("forms send their fields and can't use fetch-%s", option.name)
+		}
+	}
+
+	openTag := fe.FullElement[:strings.Index(fe.FullElement, ">")+1]
+	multipart := reEnctypeMultipart.MatchString(openTag)
+	if fe.Method != "GET" && !multipart && !strings.Contains(strings.ToLower(fe.Headers), "content-type") {
+		fe.Headers = "Content-Type: application/json; " + fe.Headers
+	}
+	req, err := compileFetchRequest(fe)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	content, children, err := extractFormChildren(fe.InnerContent)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	var refetch []string
+	if m := reRefetchAttr.FindStringSubmatch(openTag); m != nil {
+		for _, name := range strings.Split(m[1], ",") {
+			name = strings.TrimSpace(name)
+			if !reIdentifier.MatchString(name) {
+				return "", "", false, fmt.Errorf("invalid refetch name %q: expected the as name of a fetch element", name)
+			}
+			refetch = append(refetch, name)
+		}
+	}
+
+	openTag = reFormAction.ReplaceAllString(openTag, "")
+	openTag = reAsAttr.ReplaceAllString(openTag, "")
+	openTag = reFetchOption.ReplaceAllString(openTag, "")
+	openTag = reRefetchAttr.ReplaceAllString(openTag, "")
+	openTag = "<form" + fmt.Sprintf(" id=\"%s\"", fe.ID) + openTag[len("<form"):]
+
+	script := generateFormScript(fe, req, children, multipart, refetch, shared)
+	return openTag + content + "</form>", script, req.ReadsSignals, nil
+}
+
+// extractFormChildren marks the suspense, success and fallback children of a form and
+// hides them. They stay where they are in the form, success and fallback contents are
+// compiled into templates rendered with the response.
+func extractFormChildren(content string) (string, formChildren, error) {
+	var children formChildren
+	var expressions strings.Builder
+
+	compile := func(inner string) (string, error) {
+		template, err := compileFetchTemplate(inner, &expressions)
+		if err != nil {
+			return "", err
+		}
+		template, _ = processForElements(template)
+		return template, nil
+	}
+
+	for _, attr := range []string{"suspense", "success", "fallback"} {
+		for {
+			childStart := findElementWithAttr(content, attr)
+			if childStart == -1 {
+				break
+			}
+			start, end, tagName, _, attrs, inner := findElementAt(content, childStart)
+			if start == -1 {
+				break
+			}
+
+			marker := "data-gtml-" + attr
+			switch attr {
+			case "suspense":
+				children.HasSuspense = true
+				attrs = reSuspenseAttr.ReplaceAllString(attrs, " "+marker+" hidden$1")
+			case "success":
+				if children.Success != "" {
+					return "", children, fmt.Errorf("a form can only have one success child")
+				}
+				template, err := compile(inner)
+				if err != nil {
+					return "", children, err
+				}
+				children.Success = template
+				attrs = reSuccessAttr.ReplaceAllString(attrs, " "+marker+" hidden$1")
+				inner = ""
+			case "fallback":
+				status := ""
+				if m := reFallbackCode.FindStringSubmatch(attrs); m != nil {
+					status = strings.ToLower(strings.TrimSpace(m[1]))
+					if status != "" && !reStatusCode.MatchString(status) {
+						return "", children, fmt.Errorf("invalid fallback status %q: expected a code like '404' or a class like '5xx'", status)
+					}
+					attrs = reFallbackCode.ReplaceAllString(attrs, "")
+				} else {
+					attrs = reFallbackAttr.ReplaceAllString(attrs, "$1")
+				}
+				template, err := compile(inner)
+				if err != nil {
+					return "", children, err
+				}
+				children.Fallbacks = append(children.Fallbacks, fetchFallback{Status: status, Content: template})
+				attrs += fmt.Sprintf(" %s='%s' hidden", marker, status)
+				inner = ""
+			}
+
+			element := "<" + tagName + attrs + ">" + inner + "</" + tagName + ">"
+			content = content[:start] + element + content[end:]
+		}
+	}
+
+	children.Expressions = expressions.String()
+	return content, children, nil
+}
+
+// generateFormScript generates the script that submits an enhanced form through fetch
+func generateFormScript(fe FetchElement, req fetchRequest, children formChildren, multipart bool, refetch []string, shared bool) string {
+	var script strings.Builder
+	script.WriteString("\n<script>\n(function() {\n")
+	script.WriteString(fmt.Sprintf("  const form = document.getElementById('%s');\n", fe.ID))
+	script.WriteString("  if (!form) return;\n")
+	if req.ReadsSignals {
+		script.WriteString("  const instance = form.closest('[data-gtml-instance]');\n")
+		script.WriteString("  const _s = gtmlScope(instance ? instance.getAttribute('data-gtml-instance') : '');\n")
+	}
+	script.WriteString("\n")
+
+	if children.HasSuspense {
+		script.WriteString("  const suspense = form.querySelector('[data-gtml-suspense]');\n")
+	}
+	if children.Success != "" {
+		script.WriteString("  const success = form.querySelector('[data-gtml-success]');\n")
+		script.WriteString(fmt.Sprintf("  const successContent = `%s`;\n", escapeJSTemplate(children.Success)))
+	}
+	if len(children.Fallbacks) > 0 {
+		script.WriteString("  const fallbackEls = form.querySelectorAll('[data-gtml-fallback]');\n")
+		script.WriteString("  const fallbacks = [\n")
+		for i, fallback := range children.Fallbacks {
+			script.WriteString(fmt.Sprintf("    { status: '%s', template: `%s`, el: fallbackEls[%d] },\n", fallback.Status, escapeJSTemplate(fallback.Content), i))
+		}
+		script.WriteString("  ];\n")
+	}
+	if children.Expressions != "" {
+		script.WriteString("\n  // Compiled template expressions\n")
+		script.WriteString("  gtmlFetchExpressions({\n" + children.Expressions + "  });\n")
+	}
+	script.WriteString("\n")
+
+	// Render the response into the success child, responses without a body only notify
+	script.WriteString(fmt.Sprintf("  function render(%s) {\n", fe.AsName))
+	if children.Success != "" {
+		script.WriteString(fmt.Sprintf("    if (%s != null) {\n", fe.AsName))
+		script.WriteString(fmt.Sprintf("      const scope = { '%s': %s };\n", fe.AsName, fe.AsName))
+		script.WriteString("      success.replaceChildren(gtmlFillTemplate(successContent, scope));\n")
+		script.WriteString("      processForLoops(success, scope);\n")
+		script.WriteString("      success.hidden = false;\n")
+		script.WriteString("    }\n")
+	}
+	script.WriteString(fmt.Sprintf("    form.dispatchEvent(new CustomEvent('gtml:success', { detail: %s, bubbles: true }));\n", fe.AsName))
+	for _, name := range refetch {
+		script.WriteString(fmt.Sprintf("    refetch('%s');\n", name))
+	}
+	script.WriteString("  }\n\n")
+
+	// Show the fallback for the status, with the error response as error.data
+	script.WriteString("  function fail(error) {\n")
+	script.WriteString("    console.error('Form error:', error);\n")
+	script.WriteString("    form.dispatchEvent(new CustomEvent('gtml:error', { detail: error, bubbles: true }));\n")
+	if len(children.Fallbacks) > 0 {
+		script.WriteString("    const status = error.cause ? error.cause.status : 0;\n")
+		script.WriteString("    const match = gtmlFallbackFor(fallbacks, status);\n")
+		script.WriteString("    if (!match) return;\n")
+		script.WriteString("    const scope = { error: { message: error.message, status, data: error.data }, status };\n")
+		script.WriteString("    match.el.innerHTML = replaceExpressions(match.template, scope);\n")
+		script.WriteString("    processForLoops(match.el, scope);\n")
+		script.WriteString("    match.el.hidden = false;\n")
+	}
+	script.WriteString("  }\n\n")
+
+	// Submit through fetch, ignoring submits while a request is in flight
+	script.WriteString("  let pending = false;\n\n")
+	script.WriteString("  form.addEventListener('submit', event => {\n")
+	script.WriteString("    event.preventDefault();\n")
+	script.WriteString("    if (pending) return;\n")
+	script.WriteString("    pending = true;\n")
+	script.WriteString("    form.setAttribute('aria-busy', 'true');\n")
+	if children.Success != "" {
+		script.WriteString("    success.hidden = true;\n")
+	}
+	if len(children.Fallbacks) > 0 {
+		script.WriteString("    fallbacks.forEach(fallback => { fallback.el.hidden = true; });\n")
+	}
+	if children.HasSuspense {
+		script.WriteString("    suspense.hidden = false;\n")
+	}
+
+	switch {
+	case fe.Method == "GET":
+		script.WriteString(fmt.Sprintf("    fetch(gtmlFormURL(%s, form, event.submitter), { method: 'GET'%s })\n", req.URL, req.Options))
+	case multipart:
+		script.WriteString(fmt.Sprintf("    fetch(%s, { method: '%s'%s, body: new FormData(form, event.submitter) })\n", req.URL, fe.Method, req.Options))
+	default:
+		script.WriteString(fmt.Sprintf("    fetch(%s, { method: '%s'%s, body: JSON.stringify(gtmlFormValues(form, event.submitter)) })\n", req.URL, fe.Method, req.Options))
+	}
+	script.WriteString("      .then(gtmlReadResponse)\n")
+	script.WriteString(fmt.Sprintf("      .then(%s => render(%s))\n", fe.AsName, fe.AsName))
+	script.WriteString("      .catch(fail)\n")
+	script.WriteString("      .finally(() => {\n")
+	script.WriteString("        pending = false;\n")
+	script.WriteString("        form.removeAttribute('aria-busy');\n")
+	if children.HasSuspense {
+		script.WriteString("        suspense.hidden = true;\n")
+	}
+	script.WriteString("      });\n")
+	script.WriteString("  });\n\n")
+
+	if !shared {
+		for _, line := range strings.Split(strings.TrimSpace(FetchLibrary), "\n") {
+			if line == "" {
+				script.WriteString("\n")
+				continue
+			}
+			script.WriteString("  " + line + "\n")
+		}
+	}
+
+	script.WriteString("})();\n</script>\n")
+	return script.String()
+}
+
+// escapeJSTemplate escapes a string for use in JavaScript template literals
+func escapeJSTemplate(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "`", "\\`")
+	s = strings.ReplaceAll(s, "${", "\\${")
+	return s
+}
+
+type CompileOptions struct {
+	ComponentsDir string
+	RoutesDir     string
+	DistDir       string
+	StaticDir     string
+	ScopeIDs      string // Scope ID strategy, defaults to ScopeIDDebug
+
+	// FingerprintAssets content-hashes static and generated assets, rewrites
+	// references to them and writes dist/asset-manifest.json
+	FingerprintAssets bool
+
+	// SharedRuntime writes the signal and fetch helpers once to
+	// static/gtml-runtime.js and each route's generated scripts to
+	// static/gtml/<route>.js, referenced with <script src>
+	SharedRuntime bool
+
+	// Minify collapses whitespace in emitted HTML and minifies the generated
+	// CSS and inline scripts
+	Minify bool
+
+	// StaticFetchURLs lets static fetch elements request http:// and https:// urls
+	// at compile time. It is off by default so builds don't depend on the network.
+	StaticFetchURLs bool
+}
+
+// ScopeID builds the scope attribute for a component using the given strategy.
+// Hashed IDs are derived from the component name and content so they are stable
+// between builds and don't look like real data attributes. CompileProject numbers
+// the IDs of components that end up with one already in use.
+func ScopeID(name string, content string, strategy string) (string, error) {
+	sum := sha256.Sum256([]byte(name + "\x00" + content))
+	hash := hex.EncodeToString(sum[:])[:6]
+
+	switch strategy {
+	case ScopeIDName:
+		return "data-" + strings.ToLower(name), nil
+	case ScopeIDHash:
+		return "data-g-" + hash, nil
+	case "", ScopeIDDebug:
+		return "data-g-" + strings.ToLower(name) + "-" + hash, nil
+	}
+	return "", fmt.Errorf("unknown scope ID strategy '%s': must be name, hash, or debug", strategy)
+}
+
+// resetCounters restarts the generated IDs so identical input compiles to identical
+// output, which keeps fingerprints stable between watch mode rebuilds
+func resetCounters() {
+	fetchCounter = 0
+	forLoopCounter = 0
+	fetchExprCounter = 0
+	formCounter = 0
+	inlineEventCounter = 0
+	instanceCounter = 0
+	bindingCounter = 0
+}
+
+func CompileProject(basePath string, opts CompileOptions) error {
+	resetCounters()
+	state := &GlobalState{
+		Components:      make(map[string]*Component),
+		SharedRuntime:   opts.SharedRuntime,
+		BasePath:        basePath,
+		StaticFetchURLs: opts.StaticFetchURLs,
+	}
+
+	compDir := filepath.Join(basePath, opts.ComponentsDir)
+	if _, err := os.Stat(compDir); os.IsNotExist(err) {
+		return fmt.Errorf("missing required directory: %s", compDir)
+	}
+
+	// Scope IDs in use, so two components never share their scoped styles
+	scopeOwners := make(map[string]bool)
+
+	err := filepath.Walk(compDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".html" {
+			return nil
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".html")
+		if !IsPascalCase(name) {
+			return fmt.Errorf("component '%s' must be PascalCase", path)
+		}
+		if _, exists := state.Components[name]; exists {
+			return fmt.Errorf("duplicate component name found: %s", name)
+		}
+
+		contentBytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content := string(contentBytes)
+
+		content, err = ResolveStylesheetLinks(content, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("error resolving stylesheets in %s: %v", path, err)
+		}
+
+		scopeID, err := ScopeID(name, content, opts.ScopeIDs)
+		if err != nil {
+			return err
+		}
+		// A component whose ID is taken, like Mybutton after MyButton by name, gets a numbered one
+		for base, n := scopeID, 2; scopeOwners[scopeID]; n++ {
+			scopeID = fmt.Sprintf("%s-%d", base, n)
+		}
+		scopeOwners[scopeID] = true
+		template, css, err := ProcessComponentStyles(content, scopeID)
+		if err != nil {
+			return err
+		}
+
+		propDefs, template, err := ParsePropsAttribute(template)
+		if err != nil {
+			return fmt.Errorf("error parsing props in %s: %v", path, err)
+		}
+
+		emits, template, err := ParseEmitsAttribute(template)
+		if err != nil {
+			return fmt.Errorf("error parsing emits in %s: %v", path, err)
+		}
+		if err := ValidateEmits(name, template, emits); err != nil {
+			return err
+		}
+
+		if !HasSingleRoot(template) {
+			return fmt.Errorf("component '%s' must have a single root element", name)
+		}
+
+		styleProps := StyleProps(css)
+		for _, propName := range styleProps {
+			if _, ok := propDefs[propName]; !ok {
+				return fmt.Errorf("styles in component '%s' reference undefined prop: %s", name, propName)
+			}
+		}
+
+		template = InjectScopeID(template, scopeID)
+		template = InjectStyleProps(template, styleProps)
+
+		state.Components[name] = &Component{
+			Name:        name,
+			RawContent:  content,
+			Template:    template,
+			ScopedStyle: css,
+			ScopeID:     scopeID,
+			Path:        path,
+			PropDefs:    propDefs,
+			Emits:       emits,
+		}
+
+		if css != "" {
+			// Hashed IDs are meant to hide component names, so they aren't labelled
+			if opts.ScopeIDs != ScopeIDHash {
+				state.CSSOutput.WriteString("/* " + name + " */\n")
+			}
+			state.CSSOutput.WriteString(css + "\n")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	routesDir := filepath.Join(basePath, opts.RoutesDir)
+	if _, err := os.Stat(routesDir); os.IsNotExist(err) {
+		return fmt.Errorf("missing required directory: %s", routesDir)
+	}
+
+	distDir := filepath.Join(basePath, opts.DistDir)
+
+	// Compiled pages are held until static assets are written so references
+	// to fingerprinted assets can be rewritten
+	pages := make(map[string]string)
+	routeChunks := make(map[string]string)
+
+	err = filepath.Walk(routesDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if filepath.Ext(path) != ".html" {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(routesDir, path)
+		fileName := strings.TrimSuffix(filepath.Base(path), ".html")
+		if fileName != "index" && !IsKebabCase(fileName) {
+			return fmt.Errorf("route '%s' must be kebab-case", path)
+		}
+
+		contentBytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		state.InteractivityJS.Reset()
+		compiledHTML, err := CompileHTML(string(contentBytes), state, map[string]Value{}, true)
+		if err != nil {
+			return fmt.Errorf("error compiling %s: %v", path, err)
+		}
+
+		if opts.SharedRuntime && state.InteractivityJS.Len() > 0 {
+			chunkPath := "gtml/" + strings.TrimSuffix(filepath.ToSlash(relPath), ".html") + ".js"
+			routeChunks[chunkPath] = extractScriptBodies(state.InteractivityJS.String())
+			compiledHTML += fmt.Sprintf("\n<script src=\"/%s/gtml-runtime.js\"></script>\n<script src=\"/%s/%s\"></script>\n",
+				opts.StaticDir, opts.StaticDir, chunkPath)
+		}
+
+		// Inject inline CSS into the head for reliable styling
+		cssContent := state.CSSOutput.String()
+		if cssContent != "" && strings.Contains(compiledHTML, "</head>") {
+			inlineStyle := fmt.Sprintf("<style>\n%s</style>\n</head>", cssContent)
+			compiledHTML = strings.Replace(compiledHTML, "</head>", inlineStyle, 1)
+		}
+
+		pages[relPath] = compiledHTML
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	assets, modes, err := readStaticAssets(filepath.Join(basePath, opts.StaticDir))
+	if err != nil {
+		return err
+	}
+
+	// Generated files overwrite any placeholder from source static
+	generatedCSS := state.CSSOutput.String()
+	if opts.Minify {
+		generatedCSS = MinifyCSS(generatedCSS)
+	}
+	assets["styles.css"] = []byte(generatedCSS)
+
+	if len(routeChunks) > 0 {
+		routeChunks["gtml-runtime.js"] = SignalLibrary + "\n" + FetchLibrary
+	}
+	for chunkPath, js := range routeChunks {
+		if opts.Minify {
+			js = MinifyJS(js)
+		}
+		assets[chunkPath] = []byte(js)
+	}
+
+	manifest, err := writeStaticAssets(assets, modes, filepath.Join(distDir, opts.StaticDir), opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.FingerprintAssets {
+		manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(distDir, "asset-manifest.json"), manifestJSON, 0644); err != nil {
+			return err
+		}
+	}
+
+	for relPath, html := range pages {
+		if opts.Minify {
+			html = MinifyHTML(html)
+		}
+		if opts.FingerprintAssets {
+			html = RewriteAssetReferences(html, manifest)
+		}
+
+		outPath := filepath.Join(distDir, relPath)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(outPath, []byte(html), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractScriptBodies joins the contents of the generated <script> blocks in html
+func extractScriptBodies(html string) string {
+	var bodies []string
+	for _, match := range reScriptBody.FindAllStringSubmatch(html, -1) {
+		bodies = append(bodies, strings.TrimSpace(match[1]))
+	}
+	return strings.Join(bodies, "\n\n") + "\n"
+}
+
+// readStaticAssets reads every file under dir keyed by its slash-separated relative
+// path, along with the file modes
+func readStaticAssets(dir string) (map[string][]byte, map[string]fs.FileMode, error) {
+	assets := make(map[string][]byte)
+	modes := make(map[string]fs.FileMode)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return assets, modes, nil
+	}
+
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(dir, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		assets[filepath.ToSlash(relPath)] = data
+		modes[filepath.ToSlash(relPath)] = info.Mode().Perm()
+		return nil
+	})
+	return assets, modes, err
+}
+
+// writeStaticAssets writes assets into dst and returns a manifest mapping each
+// asset's public path to the path it was written to. CSS is written last so its
+// references to other fingerprinted assets can be rewritten before it is hashed.
+// Files keep their mode from modes, generated ones are written with 0644.
+func writeStaticAssets(assets map[string][]byte, modes map[string]fs.FileMode, dst string, opts CompileOptions) (map[string]string, error) {
+	manifest := make(map[string]string)
+
+	var names []string
+	for relPath := range assets {
+		names = append(names, relPath)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		iCSS, jCSS := strings.HasSuffix(names[i], ".css"), strings.HasSuffix(names[j], ".css")
+		if iCSS != jCSS {
+			return jCSS
+		}
+		return names[i] < names[j]
+	})
+
+	for _, relPath := range names {
+		data := assets[relPath]
+		outName := relPath
+		if opts.FingerprintAssets {
+			if strings.HasSuffix(relPath, ".css") {
+				data = []byte(rewriteCSSAssetReferences(string(data), manifest))
+				data = []byte(rewriteRelativeCSSURLs(string(data), relPath, opts.StaticDir, manifest))
+			}
+			outName = FingerprintPath(relPath, data)
+		}
+		manifest[opts.StaticDir+"/"+relPath] = opts.StaticDir + "/" + outName
+
+		// The original name is written too, for references that can't be rewritten
+		// like paths built in scripts
+		for _, name := range slices.Compact([]string{outName, relPath}) {
+			outPath := filepath.Join(dst, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+				return nil, err
+			}
+			mode, ok := modes[relPath]
+			if !ok {
+				mode = 0644
+			}
+			// The file is replaced so a read-only copy from an earlier build can't block
+			// the write, and chmod applies the mode regardless of the umask
+			if err := os.Remove(outPath); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if err := os.WriteFile(outPath, data, mode); err != nil {
+				return nil, err
+			}
+			if err := os.Chmod(outPath, mode); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return manifest, nil
+}
+
+// FingerprintPath inserts a short content hash before the file extension,
+// e.g. css/styles.css becomes css/styles.3fa9c1.css
+func FingerprintPath(relPath string, data []byte) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:6]
+	ext := path.Ext(relPath)
+	return strings.TrimSuffix(relPath, ext) + "." + hash + ext
+}
+
+// RewriteAssetReferences replaces absolute references to assets in the manifest
+// (e.g. /static/styles.css) with their fingerprinted paths. Only src, href and srcset
+// attributes and url() in styles are rewritten, so paths that are only mentioned,
+// like in text or <code>, are left alone.
+func RewriteAssetReferences(content string, manifest map[string]string) string {
+	rewrite := assetRefRewriter(manifest)
+	if rewrite == nil {
+		return content
+	}
+	return reAssetMarkup.ReplaceAllStringFunc(content, func(markup string) string {
+		if strings.HasSuffix(strings.ToLower(markup), "</style>") {
+			return reAssetURL.ReplaceAllStringFunc(markup, rewrite)
+		}
+		return reAssetAttr.ReplaceAllStringFunc(markup, rewrite)
+	})
+}
+
+// rewriteCSSAssetReferences replaces url() references to static assets in a stylesheet
+// with their fingerprinted paths
+func rewriteCSSAssetReferences(css string, manifest map[string]string) string {
+	rewrite := assetRefRewriter(manifest)
+	if rewrite == nil {
+		return css
+	}
+	return reAssetURL.ReplaceAllStringFunc(css, rewrite)
+}
+
+// assetRefRewriter returns a function that replaces the asset paths in a reference,
+// or nil when no asset was renamed
+func assetRefRewriter(manifest map[string]string) func(string) string {
+	var keys []string
+	for key, value := range manifest {
+		if key != value {
+			keys = append(keys, regexp.QuoteMeta(key))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	// Longest paths first so a path is never matched by one of its prefixes
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	reAssetRef := regexp.MustCompile(`/(` + strings.Join(keys, "|") + `)([\s"'?#),]|$)`)
+	return func(ref string) string {
+		return reAssetRef.ReplaceAllStringFunc(ref, func(match string) string {
+			subMatch := reAssetRef.FindStringSubmatch(match)
+			return "/" + manifest[subMatch[1]] + subMatch[2]
+		})
+	}
+}
+
+var (
+	reAssetMarkup = regexp.MustCompile(`(?is)<style\b[^>]*>.*?</style>|<[a-z](?:[^>"']|"[^"]*"|'[^']*')*>`)
+	reAssetAttr   = regexp.MustCompile(`(?i)\s(?:src|href|srcset)\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'>]+)|url\(\s*(?:"[^"]*"|'[^']*'|[^'"()]*)\s*\)`)
+	reAssetURL    = regexp.MustCompile(`url\(\s*(?:"[^"]*"|'[^']*'|[^'"()]*)\s*\)`)
+)
+
+// rewriteRelativeCSSURLs replaces url() references relative to a static stylesheet
+// (e.g. url(./img/logo.png)) with their fingerprinted names
+func rewriteRelativeCSSURLs(css string, relPath string, staticDir string, manifest map[string]string) string {
+	return reCSSURL.ReplaceAllStringFunc(css, func(match string) string {
+		m := reCSSURL.FindStringSubmatch(match)
+		ref := m[2]
+		if strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "#") || strings.Contains(ref, ":") {
+			return match
+		}
+		resolved := path.Join(path.Dir(relPath), ref)
+		hashed, ok := manifest[staticDir+"/"+resolved]
+		if !ok || strings.HasPrefix(resolved, "../") {
+			return match
+		}
+		return "url(" + m[1] + path.Join(path.Dir(ref), path.Base(hashed)) + m[3] + m[1] + ")"
+	})
+}
+
+// MinifyHTML collapses whitespace and strips comments from compiled HTML.
+// Content of <pre> and <textarea> is preserved verbatim, while inline <script>
+// and <style> blocks are passed through MinifyJS and MinifyCSS.
+func MinifyHTML(html string) string {
+	var out strings.Builder
+	writeText := func(text string) {
+		text = collapseWhitespace(text)
+		// Whitespace on both sides of a removed comment collapses into one space
+		if strings.HasPrefix(text, " ") && strings.HasSuffix(out.String(), " ") {
+			text = text[1:]
+		}
+		out.WriteString(text)
+	}
+
+	i := 0
+	for i < len(html) {
+		next, kind := nextRawHTMLBlock(html, i)
+		writeText(html[i:next])
+		if next == len(html) {
+			break
+		}
+
+		if kind == "!--" {
+			end := strings.Index(html[next:], "-->")
+			if end == -1 {
+				out.WriteString(html[next:])
+				break
+			}
+			end += next + len("-->")
+			// Keep conditional comments, which older browsers interpret
+			if strings.HasPrefix(html[next:], "<!--[if") {
+				out.WriteString(html[next:end])
+			}
+			i = end
+			continue
+		}
+
+		openEnd := strings.Index(html[next:], ">")
+		closeTag := "</" + kind
+		closeIdx := strings.Index(strings.ToLower(html[next:]), closeTag)
+		if openEnd == -1 || closeIdx == -1 {
+			out.WriteString(html[next:])
+			break
+		}
+		openEnd += next + 1
+		closeIdx += next
+
+		openTag := html[next:openEnd]
+		body := html[openEnd:closeIdx]
+		switch kind {
+		case "script":
+			if isJavaScriptTag(openTag) {
+				body = MinifyJS(body)
+			}
+		case "style":
+			body = MinifyCSS(body)
+		}
+		writeText(openTag)
+		out.WriteString(body)
+		i = closeIdx
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// nextRawHTMLBlock finds the next comment or element whose content must not be
+// collapsed, returning its position and kind, or len(html) if there is none
+func nextRawHTMLBlock(html string, from int) (int, string) {
+	lower := strings.ToLower(html[from:])
+	best, bestKind := len(html), ""
+	for _, kind := range []string{"!--", "pre", "textarea", "script", "style"} {
+		offset := 0
+		for {
+			idx := strings.Index(lower[offset:], "<"+kind)
+			if idx == -1 {
+				break
+			}
+			idx += offset
+			after := idx + 1 + len(kind)
+			if kind == "!--" || after >= len(lower) || strings.ContainsRune(" \t\n\r>/", rune(lower[after])) {
+				if from+idx < best {
+					best, bestKind = from+idx, kind
+				}
+				break
+			}
+			offset = idx + 1
+		}
+	}
+	return best, bestKind
+}
+
+func isJavaScriptTag(openTag string) bool {
+	attrs := ParseAttributes(openTag)
+	scriptType, ok := attrs["type"]
+	return !ok || scriptType == "module" || strings.Contains(scriptType, "javascript")
+}
+
+func collapseWhitespace(s string) string {
+	var out strings.Builder
+	inSpace := false
+	for i := 0; i < len(s); i++ {
+		if unicode.IsSpace(rune(s[i])) {
+			if !inSpace {
+				out.WriteByte(' ')
+				inSpace = true
+			}
+			continue
+		}
+		out.WriteByte(s[i])
+		inSpace = false
+	}
+	return out.String()
+}
+
+// MinifyCSS strips comments and redundant whitespace from css
+func MinifyCSS(css string) string {
+	out := make([]byte, 0, len(css))
+	pendingSpace := false
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				return strings.TrimSpace(string(out))
+			}
+			i += end + 3
+			pendingSpace = true
+		case c == '"' || c == '\'':
+			end := skipQuoted(css, i)
+			if pendingSpace && len(out) > 0 && !strings.ContainsRune("{};,>:", rune(out[len(out)-1])) {
+				out = append(out, ' ')
+			}
+			pendingSpace = false
+			out = append(out, css[i:end]...)
+			i = end - 1
+		case unicode.IsSpace(rune(c)):
+			pendingSpace = true
+		default:
+			if pendingSpace && len(out) > 0 && !strings.ContainsRune("{};,>", rune(c)) {
+				prev := out[len(out)-1]
+				if !strings.ContainsRune("{};,>:", rune(prev)) {
+					out = append(out, ' ')
+				}
+			}
+			pendingSpace = false
+			// Drop the semicolon before a closing brace
+			if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+				out = out[:len(out)-1]
+			}
+			out = append(out, c)
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// MinifyJS strips comments, indentation and blank lines from JavaScript. It keeps
+// line breaks wherever automatic semicolon insertion could depend on them and
+// never touches strings, template literals or regular expression literals.
+func MinifyJS(js string) string {
+	var out strings.Builder
+	pendingSpace, pendingNewline := false, false
+	// Whether each open paren follows if, while, for or with, and whether the last
+	// closed one did, since a '/' after such a condition starts a regular expression
+	var controlParens []bool
+	afterControl := false
+
+	flushWhitespace := func(next byte) {
+		if out.Len() == 0 {
+			pendingSpace, pendingNewline = false, false
+			return
+		}
+		prev := out.String()[out.Len()-1]
+		if pendingNewline && !strings.ContainsRune("{;,", rune(prev)) && !strings.ContainsRune("})]", rune(next)) {
+			out.WriteByte('\n')
+		} else if (pendingSpace || pendingNewline) && !strings.ContainsRune("{}()[];,:=&|?>", rune(prev)) && !strings.ContainsRune("{}()[];,:=&|?!", rune(next)) {
+			out.WriteByte(' ')
+		}
+		pendingSpace, pendingNewline = false, false
+	}
+
+	for i := 0; i < len(js); i++ {
+		c := js[i]
+		switch {
+		case c == '/' && i+1 < len(js) && js[i+1] == '/':
+			end := strings.IndexByte(js[i:], '\n')
+			if end == -1 {
+				i = len(js)
+			} else {
+				i += end - 1
+			}
+		case c == '/' && i+1 < len(js) && js[i+1] == '*':
+			end := strings.Index(js[i+2:], "*/")
+			if end == -1 {
+				i = len(js)
+			} else {
+				block := js[i : i+end+4]
+				i += end + 3
+				if strings.Contains(block, "\n") {
+					pendingNewline = true
+				} else {
+					pendingSpace = true
+				}
+			}
+		case c == '\n' || c == '\r':
+			pendingNewline = true
+		case unicode.IsSpace(rune(c)):
+			pendingSpace = true
+		case c == '"' || c == '\'' || c == '`':
+			flushWhitespace(c)
+			end := skipQuoted(js, i)
+			out.WriteString(js[i:end])
+			i = end - 1
+		case c == '/' && (jsRegexAllowed(out.String()) || afterControl && strings.HasSuffix(out.String(), ")")):
+			flushWhitespace(c)
+			end := skipJSRegex(js, i)
+			out.WriteString(js[i:end])
+			i = end - 1
+		default:
+			flushWhitespace(c)
+			switch c {
+			case '(':
+				controlParens = append(controlParens, jsControlKeyword(out.String()))
+			case ')':
+				afterControl = len(controlParens) > 0 && controlParens[len(controlParens)-1]
+				if len(controlParens) > 0 {
+					controlParens = controlParens[:len(controlParens)-1]
+				}
+			}
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// skipQuoted returns the index just past the string literal starting at start,
+// following ${...} substitutions inside template literals
+func skipQuoted(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == quote:
+			return i + 1
+		case quote == '`' && s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth := 0
+			for i++; i < len(s); i++ {
+				if s[i] == '"' || s[i] == '\'' || s[i] == '`' {
+					i = skipQuoted(s, i) - 1
+				} else if s[i] == '{' {
+					depth++
+				} else if s[i] == '}' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+	return len(s)
+}
+
+// jsControlKeyword reports whether the emitted code ends with a keyword whose
+// parenthesized condition is followed by a statement
+func jsControlKeyword(code string) bool {
+	code = strings.TrimRight(code, " \n")
+	wordStart := len(code)
+	for wordStart > 0 && isIdentByte(code[wordStart-1]) {
+		wordStart--
+	}
+	switch code[wordStart:] {
+	case "if", "while", "for", "with":
+		return wordStart == 0 || code[wordStart-1] != '.'
+	}
+	return false
+}
+
+// jsRegexAllowed reports whether a '/' following the emitted code starts a
+// regular expression literal rather than a division
+func jsRegexAllowed(code string) bool {
+	code = strings.TrimRight(code, " \n")
+	if code == "" {
+		return true
+	}
+	prev := code[len(code)-1]
+	if strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(prev)) {
+		return true
+	}
+	wordStart := len(code)
+	for wordStart > 0 && (isIdentByte(code[wordStart-1])) {
+		wordStart--
+	}
+	switch code[wordStart:] {
+	case "return", "typeof", "case", "in", "of", "delete", "void", "throw", "new":
+		return true
+	}
+	return false
+}
+
+func skipJSRegex(s string, start int) int {
+	inClass := false
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return i
+		case '/':
+			if !inClass {
+				i++
+				for i < len(s) && isIdentByte(s[i]) {
+					i++
+				}
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func WatchProject(basePath string, opts CompileOptions) {
+	fmt.Printf("Watching %s for changes...\n", basePath)
+	if err := CompileProject(basePath, opts); err != nil {
+		fmt.Printf("Compile Error: %v\n", err)
+	} else {
+		fmt.Println("Built successfully.")
+	}
+
+	lastMod := time.Now()
+
+	for {
+		time.Sleep(1 * time.Second)
+		needsCompile := false
+
+		filepath.Walk(basePath, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if strings.Contains(path, opts.DistDir) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.ModTime().After(lastMod) {
+				needsCompile = true
+				return errors.New("change found")
+			}
+			return nil
+		})
+
+		if needsCompile {
+			fmt.Println("Change detected. Compiling...")
+			if err := CompileProject(basePath, opts); err != nil {
+				fmt.Printf("Compile Error: %v\n", err)
+			} else {
+				fmt.Println("Built successfully.")
+			}
+			lastMod = time.Now()
+		}
+	}
+}
+
+// MockMeta is the optional <name>.meta.json next to a mock, it shapes the mock's response
+type MockMeta struct {
+	Status  int               `json:"status"`
+	Delay   string            `json:"delay"`
+	Headers map[string]string `json:"headers"`
+}
+
+// NewMockHandler answers requests from the mocks in dir. A request for GET /api/users is
+// answered by dir/GET/api/users.json, and a file or directory named like [id] matches any
+// one path segment. Mocks are read on every request so they can be edited while serving.
+// Requests without a mock are passed to next.
+func NewMockHandler(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mockMethods[r.Method] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		file := findMock(filepath.Join(dir, r.Method), strings.Split(strings.Trim(path.Clean(r.URL.Path), "/"), "/"))
+		if file == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := serveMock(w, r, file); err != nil {
+			fmt.Printf("Mock Error: %v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// mockMethods are the request methods mocks can be written for. The method names a
+// directory, so any other method, like "..", is passed on instead of read from disk.
+var mockMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// findMock returns the mock file for the path segments under dir, preferring exact names
+// over [param] names, or "" when there is none
+func findMock(dir string, segments []string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	segment, last := segments[0], len(segments) == 1
+
+	var params []fs.DirEntry
+	for _, entry := range entries {
+		name := entry.Name()
+		if last {
+			name = strings.TrimSuffix(name, ".json")
+			if entry.IsDir() || name == entry.Name() || strings.HasSuffix(name, ".meta") {
+				continue
+			}
+		} else if !entry.IsDir() {
+			continue
+		}
+		if name == segment && segment != "" {
+			if last {
+				return filepath.Join(dir, entry.Name())
+			}
+			if file := findMock(filepath.Join(dir, entry.Name()), segments[1:]); file != "" {
+				return file
+			}
+		} else if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+			params = append(params, entry)
+		}
+	}
+
+	for _, entry := range params {
+		if segment == "" {
+			break
+		}
+		if last {
+			return filepath.Join(dir, entry.Name())
+		}
+		if file := findMock(filepath.Join(dir, entry.Name()), segments[1:]); file != "" {
+			return file
+		}
+	}
+	return ""
+}
+
+// serveMock writes a mock's body with the status, delay and headers of its meta file
+func serveMock(w http.ResponseWriter, r *http.Request, file string) error {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	meta := MockMeta{Status: http.StatusOK}
+	metaFile := strings.TrimSuffix(file, ".json") + ".meta.json"
+	if data, err := os.ReadFile(metaFile); err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("invalid mock meta %s: %v", metaFile, err)
+		}
+		if meta.Status == 0 {
+			meta.Status = http.StatusOK
+		}
+		if http.StatusText(meta.Status) == "" {
+			return fmt.Errorf("invalid status %d in %s", meta.Status, metaFile)
+		}
+	}
+
+	if meta.Delay != "" {
+		delay, err := time.ParseDuration(meta.Delay)
+		if err != nil {
+			return fmt.Errorf("invalid delay %q in %s: expected a duration like '800ms'", meta.Delay, metaFile)
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+
+	if len(strings.TrimSpace(string(body))) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	for name, value := range meta.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(meta.Status)
+	if meta.Status != http.StatusNoContent && meta.Status != http.StatusNotModified {
+		w.Write(body)
+	}
+	return nil
+}
+
+// NewDistHandler serves a compiled project's dist directory, with routes available
+// without their .html extension
+func NewDistHandler(distDir string) http.Handler {
+	files := http.FileServer(http.Dir(distDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if urlPath != "/" && path.Ext(urlPath) == "" {
+			if info, err := os.Stat(filepath.Join(distDir, filepath.FromSlash(urlPath)+".html")); err == nil && !info.IsDir() {
+				r.URL.Path = urlPath + ".html"
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// ServeProject compiles and watches a project like WatchProject while serving dist on
+// addr. Requests matching a mock in the project's mocks directory are answered by it.
+func ServeProject(basePath string, addr string, mocksDir string, opts CompileOptions) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	handler := NewMockHandler(filepath.Join(basePath, mocksDir), NewDistHandler(filepath.Join(basePath, opts.DistDir)))
+	go func() {
+		if err := http.Serve(listener, handler); err != nil {
+			fmt.Printf("Server Error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	fmt.Printf("Serving %s on http://%s\n", basePath, listener.Addr())
+	WatchProject(basePath, opts)
+	return nil
 }
 
 const SignalLibrary = `// GTML Signal Library
@@ -2007,410 +5028,1770 @@ class GtmlSignal {
     this._subscribers = [];
   }
 
-  get value() {
-    return this._value;
+  get value() {
+    if (_gtmlActiveEffect) _gtmlActiveEffect.track(this);
+    return this._value;
+  }
+
+  set value(newValue) {
+    const oldValue = this._value;
+    this._value = newValue;
+    this._subscribers.forEach(callback => callback(newValue, oldValue));
+  }
+
+  subscribe(callback) {
+    this._subscribers.push(callback);
+    return () => {
+      this._subscribers = this._subscribers.filter(cb => cb !== callback);
+    };
+  }
+
+  update(fn) {
+    this.value = fn(this._value);
+  }
+}
+
+function createSignal(initialValue) {
+  return new GtmlSignal(initialValue);
+}
+
+// The effect currently running, signals read while it runs become its dependencies
+let _gtmlActiveEffect = null;
+
+class GtmlEffect {
+  constructor(fn) {
+    this.fn = fn;
+    this.deps = [];
+    this.running = false;
+    this.run();
+  }
+
+  track(signal) {
+    if (this.deps.some(dep => dep.signal === signal)) return;
+    this.deps.push({ signal, unsubscribe: signal.subscribe(() => this.run()) });
+  }
+
+  run() {
+    if (this.running) return;
+    this.running = true;
+    this.stop();
+    const previous = _gtmlActiveEffect;
+    _gtmlActiveEffect = this;
+    try {
+      this.fn();
+    } finally {
+      _gtmlActiveEffect = previous;
+      this.running = false;
+    }
+  }
+
+  stop() {
+    this.deps.forEach(dep => dep.unsubscribe());
+    this.deps = [];
+  }
+}
+
+function gtmlEffect(fn) {
+  return new GtmlEffect(fn);
+}
+
+// gtmlUntracked runs fn without making the signals it reads dependencies of the running effect
+function gtmlUntracked(fn) {
+  const previous = _gtmlActiveEffect;
+  _gtmlActiveEffect = null;
+  try {
+    return fn();
+  } finally {
+    _gtmlActiveEffect = previous;
+  }
+}
+
+function gtmlComputed(fn, signal = new GtmlSignal(null)) {
+  gtmlEffect(() => {
+    signal.value = fn();
+  });
+  return signal;
+}
+
+const _gtmlSignalStore = new Map();
+
+function getSignal(name) {
+  if (!_gtmlSignalStore.has(name)) {
+    _gtmlSignalStore.set(name, new GtmlSignal(null));
+  }
+  return _gtmlSignalStore.get(name);
+}
+
+function setSignal(name, value) {
+  const signal = getSignal(name);
+  signal.value = value;
+}
+
+function initSignal(name, value) {
+  if (!_gtmlSignalStore.has(name)) {
+    _gtmlSignalStore.set(name, new GtmlSignal(value));
+  }
+}
+
+const _gtmlListeners = new Map();
+
+// Page-wide event bus for cross-component events. Listeners receive the payload
+// and { name, source }, where source is the emitting instance's root element.
+function gtmlOn(name, fn) {
+  if (!_gtmlListeners.has(name)) {
+    _gtmlListeners.set(name, new Set());
   }
+  _gtmlListeners.get(name).add(fn);
+  return () => _gtmlListeners.get(name).delete(fn);
+}
 
-  set value(newValue) {
-    const oldValue = this._value;
-    this._value = newValue;
-    this._subscribers.forEach(callback => callback(newValue, oldValue));
+function gtmlEmit(name, payload, source = null) {
+  Array.from(_gtmlListeners.get(name) || []).forEach(fn => fn(payload, { name, source }));
+  document.dispatchEvent(new CustomEvent('gtml:' + name, { detail: payload }));
+}
+
+function _gtmlStorage(kind) {
+  try {
+    return kind === 'session' ? window.sessionStorage : window.localStorage;
+  } catch (e) {
+    return null;
   }
+}
 
-  subscribe(callback) {
-    this._subscribers.push(callback);
-    return () => {
-      this._subscribers = this._subscribers.filter(cb => cb !== callback);
-    };
+// Signals by storage and key, so instances persisted under the same key stay in sync.
+// Storage events only reach other tabs.
+const _gtmlPersistedSignals = new Map();
+
+// Hydrates a signal from localStorage (or sessionStorage) and writes every change back.
+// Values are stored as JSON under options.key.
+function persistSignal(name, initialValue, options = {}) {
+  const signal = getSignal(name);
+  const storage = _gtmlStorage(options.storage);
+  const key = options.key || 'gtml:' + name;
+  let value = initialValue;
+  const stored = storage ? storage.getItem(key) : null;
+  if (stored !== null) {
+    try {
+      value = JSON.parse(stored);
+    } catch (e) {
+      value = initialValue;
+    }
   }
+  signal.value = value;
+  if (storage && !signal._gtmlPersisted) {
+    signal._gtmlPersisted = true;
+    const id = (options.storage === 'session' ? 'session:' : 'local:') + key;
+    if (!_gtmlPersistedSignals.has(id)) _gtmlPersistedSignals.set(id, []);
+    const group = _gtmlPersistedSignals.get(id);
+    group.push(signal);
+    signal.subscribe(newVal => {
+      try {
+        storage.setItem(key, JSON.stringify(newVal));
+      } catch (e) {}
+      group.forEach(other => {
+        if (other !== signal && other._value !== newVal) other.value = newVal;
+      });
+    });
+  }
+  return signal;
+}
 
-  update(fn) {
-    this.value = fn(this._value);
+function _gtmlBindSignalValue(el) {
+  if (el._gtmlBound) return;
+  el._gtmlBound = true;
+  const signal = getSignal(el.getAttribute('data-gtml-signal-value'));
+  signal.subscribe((newVal) => {
+    el.textContent = newVal;
+  });
+  el.textContent = signal.value;
+}
+
+function _gtmlEscape(value) {
+  return String(value ?? '').replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[c]);
+}
+
+function _gtmlPath(value, path) {
+  if (!path) return value;
+  return path.split('.').reduce((v, key) => (v === null || v === undefined ? undefined : v[key]), value);
+}
+
+// Fills {item} and {item.field} expressions in a list template, and {#index} with the
+// compiled expression at that index
+function _gtmlRenderItem(source, name, item, exprs) {
+  return source.replace(/\{\s*([a-zA-Z_$][\w$]*)((?:\.[\w$]+)*)\s*\}|\{#(\d+)\}/g, (match, root, path, index) => {
+    if (index !== undefined) return _gtmlEscape(exprs[index](item));
+    if (root !== name) return match;
+    return _gtmlEscape(_gtmlPath(item, path.slice(1)));
+  });
+}
+
+// Finds the value of a list item variable for an element rendered by bindList
+function _gtmlLoopValue(el, name) {
+  for (let node = el; node; node = node.parentElement) {
+    if (node._gtmlLoop && name in node._gtmlLoop) return node._gtmlLoop[name];
   }
+  return undefined;
 }
 
-function createSignal(initialValue) {
-  return new GtmlSignal(initialValue);
+function _gtmlWhenReady(fn) {
+  if (document.readyState === 'loading') {
+    document.addEventListener('DOMContentLoaded', fn);
+  } else {
+    fn();
+  }
 }
 
-const _gtmlSignalStore = new Map();
+// Boolean attributes such as disabled are removed when their value is false
+function _gtmlSetAttribute(el, name, value) {
+  if (value === false || value === null || value === undefined) {
+    el.removeAttribute(name);
+  } else {
+    el.setAttribute(name, value === true ? '' : value);
+  }
+}
 
-function getSignal(name) {
-  if (!_gtmlSignalStore.has(name)) {
-    _gtmlSignalStore.set(name, new GtmlSignal(null));
+// A GtmlScope namespaces signals and element lookups to one component instance.
+// The page-level scope has an empty id and owns everything outside instances.
+class GtmlScope {
+  constructor(id) {
+    this.id = id;
+    this.root = id ? document.querySelector('[data-gtml-instance="' + id + '"]') : document.documentElement;
+  }
+
+  key(name) {
+    return this.id ? this.id + ':' + name : name;
+  }
+
+  signal(name) {
+    return getSignal(this.key(name));
+  }
+
+  get(name) {
+    return this.signal(name).value;
+  }
+
+  set(name, value) {
+    this.signal(name).value = value;
+  }
+
+  init(name, value) {
+    initSignal(this.key(name), value);
+  }
+
+  // Runs fn on the signal's value and notifies subscribers, for changes made in place
+  mutate(name, fn) {
+    let result;
+    this.signal(name).update(value => {
+      result = fn(value);
+      return value;
+    });
+    return result;
+  }
+
+  // Persisted signals share storage by name across instances and pages unless options.key is set
+  persist(name, initialValue, options = {}) {
+    return persistSignal(this.key(name), initialValue, { key: 'gtml:' + name, ...options });
+  }
+
+  emit(name, payload) {
+    gtmlEmit(name, payload, this.root);
+  }
+
+  // Reloads the fetch elements named name inside this instance
+  refetch(name) {
+    if (window.refetch) window.refetch(name, this.root);
+  }
+
+  on(name, fn) {
+    return gtmlOn(name, fn);
+  }
+
+  computed(name, fn) {
+    return gtmlComputed(fn, this.signal(name));
+  }
+
+  effect(fn) {
+    return gtmlEffect(fn);
+  }
+
+  // Elements inside a nested interactive instance belong to that instance
+  owns(el) {
+    const instance = el.closest('[data-gtml-instance]');
+    return this.id ? instance === this.root : instance === null;
+  }
+
+  $(selector) {
+    return this.$$(selector)[0] || null;
+  }
+
+  $$(selector) {
+    if (!this.root) return [];
+    const matches = Array.from(this.root.querySelectorAll(selector));
+    if (this.root.matches(selector)) matches.unshift(this.root);
+    return matches.filter(el => this.owns(el));
+  }
+
+  // Events are delegated from the document so elements rendered later are covered
+  bindEvent(type, key, handler) {
+    const selector = '[data-gtml-on-' + type + '="' + key + '"]';
+    const capture = ['focus', 'blur', 'mouseenter', 'mouseleave', 'load', 'error', 'scroll'].includes(type);
+    document.addEventListener(type, event => {
+      const el = event.target.closest && event.target.closest(selector);
+      if (el) handler.call(el, event);
+    }, capture);
+  }
+
+  bindText(key, fn) {
+    document.querySelectorAll('[data-gtml-bind="' + key + '"]').forEach(el => {
+      gtmlEffect(() => {
+        el.textContent = fn() ?? '';
+      });
+    });
+  }
+
+  bindAttr(key, name, fn) {
+    document.querySelectorAll('[data-gtml-bind="' + key + '"]').forEach(el => {
+      gtmlEffect(() => _gtmlSetAttribute(el, name, fn()));
+    });
+  }
+
+  // Two-way binding between a form control's value or checked state and a signal
+  bindInput(key, prop, name) {
+    const signal = this.signal(name);
+    document.querySelectorAll('[data-gtml-bind="' + key + '"]').forEach(el => {
+      const read = () => {
+        if (prop === 'checked') return el.checked;
+        if (el.type === 'number' || el.type === 'range') return isNaN(el.valueAsNumber) ? null : el.valueAsNumber;
+        return el.value;
+      };
+      if (signal.value === null || signal.value === undefined) signal.value = read();
+
+      const event = prop === 'checked' || el.tagName === 'SELECT' ? 'change' : 'input';
+      el.addEventListener(event, () => {
+        signal.value = read();
+      });
+      gtmlEffect(() => {
+        const value = signal.value;
+        if (prop === 'checked') {
+          el.checked = !!value;
+        } else if (el.value !== String(value ?? '')) {
+          el.value = value ?? '';
+        }
+      });
+    });
+  }
+
+  // Renders one copy of source per item after the anchor. Items are matched to
+  // existing nodes by key, so only added, removed or changed items touch the DOM.
+  // Signals read by item expressions re-render the list as well.
+  bindList(key, name, signalName, keyPath, source, exprs = []) {
+    document.querySelectorAll('template[data-gtml-list="' + key + '"]').forEach(anchor => {
+      let entries = new Map();
+      gtmlEffect(() => {
+        const items = this.get(signalName) || [];
+        const next = new Map();
+        let cursor = anchor;
+        items.forEach(item => {
+          let id = keyPath === null ? item : _gtmlPath(item, keyPath);
+          if (next.has(id)) id = Symbol();
+          const html = _gtmlRenderItem(source, name, item, exprs);
+          let entry = entries.get(id);
+          if (!entry || entry.html !== html) {
+            const tpl = document.createElement('template');
+            tpl.innerHTML = html;
+            tpl.content.querySelectorAll('[data-gtml-if]').forEach(el => {
+              if (el.getAttribute('data-gtml-if') === 'false') el.remove();
+              else el.removeAttribute('data-gtml-if');
+            });
+            tpl.content.querySelectorAll('[data-gtml-signal-value]').forEach(_gtmlBindSignalValue);
+            entry = { html, node: tpl.content.firstElementChild };
+          }
+          if (entry.node) {
+            entry.node._gtmlLoop = { [name]: item };
+            if (cursor.nextSibling !== entry.node) cursor.after(entry.node);
+            cursor = entry.node;
+          }
+          next.set(id, entry);
+        });
+        entries.forEach((entry, id) => {
+          if (next.get(id) !== entry && entry.node) entry.node.remove();
+        });
+        entries = next;
+      });
+    });
+  }
+
+  // Attaches or detaches a conditional element. The first toggle waits until the
+  // page has loaded so bindings and nested components inside it are set up first.
+  bindIf(key, fn) {
+    document.querySelectorAll('[data-gtml-bind="' + key + '"]').forEach(el => {
+      const anchor = document.createComment('gtml-if');
+      el.before(anchor);
+      _gtmlWhenReady(() => {
+        _gtmlRestoreStyle(el);
+        gtmlEffect(() => {
+          if (fn()) {
+            if (!el.isConnected) anchor.after(el);
+          } else {
+            el.remove();
+          }
+        });
+      });
+    });
+  }
+
+  render() {
+    document.querySelectorAll('[data-gtml-signal-value]').forEach(el => {
+      const key = el.getAttribute('data-gtml-signal-value');
+      const local = this.id ? key.startsWith(this.id + ':') : key.indexOf(':') === -1;
+      if (local) _gtmlBindSignalValue(el);
+    });
   }
-  return _gtmlSignalStore.get(name);
 }
 
-function setSignal(name, value) {
-  const signal = getSignal(name);
-  signal.value = value;
+// Replaces the display: none a conditional element starts with by its own style,
+// unless a style binding has set the style since
+function _gtmlRestoreStyle(el) {
+  const style = el.getAttribute('data-gtml-style');
+  el.removeAttribute('data-gtml-style');
+  if (el.getAttribute('style') !== 'display: none') return;
+  if (style === null) el.removeAttribute('style');
+  else el.setAttribute('style', style);
+}
+
+const _gtmlScopes = new Map();
+
+function gtmlScope(id) {
+  if (!_gtmlScopes.has(id)) {
+    _gtmlScopes.set(id, new GtmlScope(id));
+  }
+  return _gtmlScopes.get(id);
+}
+`
+
+const FetchLibrary = `// GTML Fetch Library
+// Fetch elements register by their 'as' name so refetch(name) can reload them. The
+// registry and the cache live on window because inline fetch scripts each carry a copy
+// of this library, after the code that uses it.
+function _gtmlFetches() {
+  return window._gtmlFetchRegistry || (window._gtmlFetchRegistry = []);
+}
+
+function _gtmlFetchCache() {
+  return window._gtmlFetchResponses || (window._gtmlFetchResponses = new Map());
+}
+
+function refetch(name, root) {
+  _gtmlFetches().forEach(entry => {
+    if (entry.name !== name || !entry.container.isConnected) return;
+    if (root && !root.contains(entry.container)) return;
+    entry.load();
+  });
+}
+window.refetch = window.refetch || refetch;
+
+// Stale-while-revalidate: cached data for the request is rendered right away, then the
+// request revalidates it unless the data is younger than maxAge. Identical requests
+// in flight are shared. Entries are keyed by the url and the request options, and a
+// failed revalidation keeps the stale data on screen.
+function gtmlCachedFetch(url, options, maxAge, onData) {
+  const key = url + ' ' + JSON.stringify(options);
+  let entry = _gtmlFetchCache().get(key);
+  if (!entry) {
+    entry = { data: undefined, time: 0, request: null };
+    _gtmlFetchCache().set(key, entry);
+  }
+  const stale = entry.data !== undefined;
+  if (stale) {
+    onData(entry.data);
+    if (Date.now() - entry.time < maxAge) return Promise.resolve();
+  }
+  if (!entry.request) {
+    entry.request = fetch(url, options)
+      .then(response => {
+        if (!response.ok) throw new Error('Request failed with status ' + response.status, { cause: response });
+        return response.json();
+      })
+      .then(data => {
+        entry.data = data;
+        entry.time = Date.now();
+        return data;
+      })
+      .finally(() => {
+        entry.request = null;
+      });
+  }
+  return entry.request.then(onData, error => {
+    if (!stale) throw error;
+    console.error('Fetch revalidation failed, keeping cached data:', error);
+  });
+}
+
+// gtmlFallbackFor picks the fallback for a response status: an exact code like '404',
+// then a class like '5xx', then the fallback without a status. Network errors have status 0.
+function gtmlFallbackFor(fallbacks, status) {
+  const code = String(status);
+  return fallbacks.find(fallback => fallback.status === code)
+    || fallbacks.find(fallback => status > 0 && fallback.status === code[0] + 'xx')
+    || fallbacks.find(fallback => fallback.status === '')
+    || null;
+}
+
+// Process all for loops recursively. Each item gets its own scope with the item, the
+// optional index and loop, outer loop variables stay visible and loop.parent is the outer loop.
+function processForLoops(element, scope) {
+  outerForTemplates(element).forEach(template => {
+    const itemName = template.getAttribute('data-gtml-item');
+    const indexName = template.getAttribute('data-gtml-index');
+    const sourcePath = template.getAttribute('data-gtml-source');
+    // Get source data from scope using path
+    const source = getValueByPath(scope, sourcePath);
+    if (!Array.isArray(source)) {
+      template.remove();
+      return;
+    }
+    const parent = template.parentNode;
+    source.forEach((item, index) => {
+      // Create new scope with current item
+      const newScope = Object.assign({}, scope);
+      newScope[itemName] = item;
+      if (indexName) newScope[indexName] = index;
+      newScope.loop = { index, first: index === 0, last: index === source.length - 1, length: source.length, parent: scope.loop };
+      const clone = renderForItem(template, newScope);
+      // Recursively process nested for loops
+      processForLoops(clone, newScope);
+      parent.insertBefore(clone, template);
+    });
+    template.remove();
+  });
+}
+
+// Fills in the expressions of a template outside its for templates and returns the
+// content. For templates are set aside so values filled in here are never scanned again.
+function gtmlFillTemplate(html, scope) {
+  const wrapper = document.createElement('template');
+  wrapper.innerHTML = html;
+  const nested = outerForTemplates(wrapper.content);
+  nested.forEach((inner, i) => {
+    const slot = document.createElement('template');
+    slot.setAttribute('data-gtml-slot', i);
+    inner.replaceWith(slot);
+  });
+  wrapper.innerHTML = replaceExpressions(wrapper.innerHTML, scope);
+  nested.forEach((inner, i) => wrapper.content.querySelector('[data-gtml-slot="' + i + '"]').replaceWith(inner));
+  return wrapper.content;
+}
+
+// Renders one item of a for template. Nested for templates are set aside while
+// expressions are replaced so they are filled in with their own item's scope.
+function renderForItem(template, scope) {
+  const clone = template.cloneNode(true);
+  clone.removeAttribute('data-gtml-for');
+  clone.removeAttribute('data-gtml-item');
+  clone.removeAttribute('data-gtml-index');
+  clone.removeAttribute('data-gtml-source');
+  clone.style.display = '';
+  const nested = outerForTemplates(clone);
+  nested.forEach((inner, i) => {
+    const slot = document.createElement('template');
+    slot.setAttribute('data-gtml-slot', i);
+    inner.replaceWith(slot);
+  });
+  // Replace expressions in text nodes and attributes, including the item element's own
+  const wrapper = document.createElement('template');
+  wrapper.innerHTML = replaceExpressions(clone.outerHTML, scope);
+  const rendered = wrapper.content.firstElementChild;
+  nested.forEach((inner, i) => rendered.querySelector('[data-gtml-slot="' + i + '"]').replaceWith(inner));
+  return rendered;
+}
+
+// Returns the for templates in root that aren't inside another for template in root
+function outerForTemplates(root) {
+  return Array.from(root.querySelectorAll('[data-gtml-for]')).filter(template => {
+    const outer = template.parentElement && template.parentElement.closest('[data-gtml-for]');
+    return !outer || !root.contains(outer);
+  });
+}
+
+// Keeps keyed elements from the previous render that didn't change, so re-rendered
+// lists don't rebuild unchanged items
+function gtmlReconcile(container, next) {
+  const previous = new Map();
+  container.querySelectorAll('[data-gtml-key]').forEach(el => previous.set(el.getAttribute('data-gtml-key'), el));
+  next.querySelectorAll('[data-gtml-key]').forEach(el => {
+    const old = previous.get(el.getAttribute('data-gtml-key'));
+    if (old && old.isEqualNode(el)) el.replaceWith(old);
+  });
+  container.replaceChildren(...next.childNodes);
+}
+
+// Get value from object by dot-notation path
+function getValueByPath(obj, path) {
+  const parts = path.split('.');
+  let value = obj[parts[0]];
+  for (let i = 1; i < parts.length && value !== undefined && value !== null; i++) {
+    value = value[parts[i]];
+  }
+  return value;
+}
+
+// Template expressions compiled by gtml, referenced from templates as {#key}
+function _gtmlFetchExpressionTable() {
+  return window._gtmlFetchExpressionTable || (window._gtmlFetchExpressionTable = new Map());
+}
+
+function gtmlFetchExpressions(entries) {
+  Object.keys(entries).forEach(key => _gtmlFetchExpressionTable().set(key, entries[key]));
+}
+
+// Evaluates {expr}, leaving undefined when it reads a name the scope doesn't have yet
+// so loop expressions wait for their loop
+function _gtmlFetchValue(expr, scope) {
+  if (expr[0] === '#') {
+    const compiled = _gtmlFetchExpressionTable().get(expr.slice(1));
+    if (!compiled || compiled.roots.some(root => !(root in scope))) return undefined;
+    const value = compiled.fn(scope);
+    return value === undefined || value === null ? '' : value;
+  }
+  // Try to resolve the expression from scope
+  const parts = expr.split('.');
+  let value = scope[parts[0]];
+  for (let i = 1; i < parts.length && value !== undefined; i++) {
+    value = value === null ? undefined : value[parts[i]];
+  }
+  return value;
+}
+
+// Helper function to replace expressions like {user.name} with HTML-escaped values.
+// {@html user.bio} inserts trusted markup as is, except inside attributes where values
+// always go through _gtmlAttrValue.
+function replaceExpressions(html, scope) {
+  return html.replace(/\{([^}]+)\}/g, (match, expr, offset) => {
+    expr = expr.trim();
+    const raw = expr.startsWith('@html ');
+    if (raw) expr = expr.slice(6).trim();
+    const value = _gtmlFetchValue(expr, scope);
+    if (value === undefined) return match;
+    const attr = _gtmlAttrContext(html, offset);
+    if (attr) return _gtmlAttrValue(attr, value, scope);
+    return raw ? String(value) : escapeHTML(value);
+  });
+}
+
+// Finds the attribute of the opening tag the expression at offset is in. Returns null
+// outside a tag and an empty name outside an attribute value. Matches attrContext in gtml.
+function _gtmlAttrContext(html, offset) {
+  const start = html.lastIndexOf('<', offset);
+  if (start <= html.lastIndexOf('>', offset)) return null;
+  const tag = html.slice(start + 1, offset);
+  const isSpace = c => c === ' ' || c === '\t' || c === '\n' || c === '\r' || c === '\f';
+  // Skips over earlier expressions, their text can contain spaces
+  const next = i => tag[i] === '{' && tag.indexOf('}', i) !== -1 ? tag.indexOf('}', i) + 1 : i + 1;
+  let i = 0;
+  while (i < tag.length && !isSpace(tag[i]) && tag[i] !== '/') i = next(i);
+  for (;;) {
+    while (i < tag.length && (isSpace(tag[i]) || tag[i] === '/')) i++;
+    const nameStart = i;
+    while (i < tag.length && !isSpace(tag[i]) && tag[i] !== '/' && tag[i] !== '=') i = next(i);
+    if (i >= tag.length) return { name: '', quote: '', value: '' };
+    const name = tag.slice(nameStart, i);
+    while (i < tag.length && isSpace(tag[i])) i++;
+    if (i >= tag.length || tag[i] !== '=') continue;
+    i++;
+    while (i < tag.length && isSpace(tag[i])) i++;
+    if (i >= tag.length) return { name, quote: '', value: '' };
+    const quote = tag[i];
+    if (quote === '"' || quote === "'") {
+      const end = tag.indexOf(quote, i + 1);
+      if (end === -1) return { name, quote, value: tag.slice(i + 1) };
+      i = end + 1;
+      continue;
+    }
+    const valueStart = i;
+    while (i < tag.length && !isSpace(tag[i])) i = next(i);
+    if (i >= tag.length) return { name, quote: '', value: tag.slice(valueStart) };
+  }
+}
+
+// Renders a value inside an attribute. Event handler attributes never get data, URL
+// attributes never get a script URL and unquoted values are escaped so they can't end early.
+function _gtmlAttrValue(attr, value, scope) {
+  if (/^on./i.test(attr.name)) return '';
+  let text = String(value);
+  if (/` + urlAttrPattern + `/i.test(attr.name)) {
+    // Earlier expressions in the value count towards its scheme
+    const before = attr.value.replace(/\{([^}]+)\}/g, (match, expr) => {
+      const earlier = _gtmlFetchValue(expr.trim().replace(/^@html\s+/, ''), scope);
+      return earlier === undefined ? match : String(earlier);
+    });
+    // Browsers ignore tabs and newlines anywhere in a URL and control characters around it
+    if (/` + scriptURLPattern + `/i.test((before + text).replace(/[\x00-\x20]/g, ''))) text = 'about:blank';
+  }
+  return attr.quote ? escapeHTML(text) : _gtmlEscapeUnquoted(text);
+}
+
+// Escapes everything but a few URL-safe characters as a character reference
+function _gtmlEscapeUnquoted(value) {
+  return String(value).replace(/[^\w.\-:\/?#%@,;!~+*()]/gu, c => '&#' + c.codePointAt(0) + ';');
+}
+
+// Escapes a value for HTML text and quoted attribute values. Braces are escaped so a
+// value is never read as an expression by a later pass.
+function escapeHTML(value) {
+  return String(value).replace(/[&<>"'{}]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;', '{': '&#123;', '}': '&#125;' })[c]);
+}
+
+// Serializes a form's fields, and the button that submitted it, to an object. Fields
+// that share a name, like checkbox groups, become arrays.
+function gtmlFormValues(form, submitter) {
+  const values = {};
+  new FormData(form, submitter).forEach((value, name) => {
+    values[name] = name in values ? [].concat(values[name], value) : value;
+  });
+  return values;
+}
+
+// Adds a form's fields to the query string of a GET submission
+function gtmlFormURL(url, form, submitter) {
+  const query = new URLSearchParams(new FormData(form, submitter)).toString();
+  if (!query) return url;
+  return url + (url.includes('?') ? '&' : '?') + query;
+}
+
+// Reads a form submission's response. An empty body is null and a body that isn't JSON
+// is kept as text. Failed requests throw with the response as cause and the body as data.
+function gtmlReadResponse(response) {
+  return response.text().then(text => {
+    let data = text || null;
+    try {
+      if (text) data = JSON.parse(text);
+    } catch (e) {}
+    if (!response.ok) {
+      const error = new Error('Request failed with status ' + response.status, { cause: response });
+      error.data = data;
+      throw error;
+    }
+    return data;
+  });
+}
+`
+
+// inlineEventCounter is used to generate unique keys for inline gtml events
+var inlineEventCounter int
+
+// instanceCounter is used to generate unique IDs for interactive component instances
+var instanceCounter int
+
+// isInteractive reports whether a component template needs its own signal namespace
+func isInteractive(template string) bool {
+	return reGtmlScript.MatchString(template) || reInlineGtmlEvent.MatchString(template) || strings.Contains(template, "{$") ||
+		reListForAttr.MatchString(template) || reSignalIf.MatchString(template)
+}
+
+// signalKey namespaces a signal name by component instance
+func signalKey(instanceID string, name string) string {
+	if instanceID == "" {
+		return name
+	}
+	return instanceID + ":" + name
+}
+
+// replaceSignalPlaceholders turns {$name} reads, and {name} reads of the given signals,
+// into spans that the runtime keeps in sync with the instance's signals
+func replaceSignalPlaceholders(html string, signals map[string]bool, instanceID string) string {
+	var result strings.Builder
+	last := 0
+	for _, loc := range reSignalPlaceholder.FindAllStringSubmatchIndex(html, -1) {
+		name := html[loc[4]:loc[5]]
+		isSignalRead := loc[2] != loc[3] || signals[name]
+		if !isSignalRead || isInsideTag(html, loc[0]) || isInsideScriptTag(html, loc[0]) {
+			continue
+		}
+		result.WriteString(html[last:loc[0]])
+		result.WriteString(fmt.Sprintf("<span data-gtml-signal-value='%s'></span>", signalKey(instanceID, name)))
+		last = loc[1]
+	}
+	result.WriteString(html[last:])
+	return result.String()
+}
+
+// isInsideTag checks if the given position is inside an element's opening tag
+func isInsideTag(html string, pos int) bool {
+	for i := pos - 1; i >= 0; i-- {
+		if html[i] == '>' {
+			return false
+		}
+		if html[i] == '<' {
+			return true
+		}
+	}
+	return false
+}
+
+// jsValue formats a prop value as a JavaScript literal
+func jsValue(v Value) string {
+	switch v.Type {
+	case PropTypeString:
+		encoded, _ := json.Marshal(v.StrVal)
+		return string(encoded)
+	case PropTypeInt:
+		return strconv.Itoa(v.IntVal)
+	case PropTypeBoolean:
+		return strconv.FormatBool(v.BoolVal)
+	}
+	return "null"
+}
+
+// signalInitCode initializes every signal a script uses, seeding signals that
+// share a name with a prop from the prop's value
+func signalInitCode(signals map[string]bool, props map[string]Value) string {
+	var names []string
+	for sigName := range signals {
+		names = append(names, sigName)
+	}
+	sort.Strings(names)
+
+	var code strings.Builder
+	for _, sigName := range names {
+		value := "null"
+		if propVal, ok := props[sigName]; ok {
+			value = jsValue(propVal)
+		}
+		code.WriteString(fmt.Sprintf("  _s.init('%s', %s);\n", sigName, value))
+	}
+	return code.String()
+}
+
+// buildInstanceScript wraps compiled gtml code in an IIFE bound to the instance's scope
+func buildInstanceScript(instanceID string, body string) string {
+	return fmt.Sprintf("\n<script>\n(function() {\n  const _s = gtmlScope('%s');\n%s\n  _s.render();\n})();\n</script>\n",
+		instanceID, strings.TrimRight(body, "\n"))
+}
+
+func ProcessInlineEvents(html string, props map[string]Value, instanceID string) (string, string, error) {
+	matches := reInlineGtmlEvent.FindAllStringSubmatchIndex(html, -1)
+
+	if len(matches) == 0 {
+		return html, "", nil
+	}
+
+	signals := make(map[string]bool)
+	var bindings strings.Builder
+	var result strings.Builder
+	last := 0
+
+	for _, match := range matches {
+		eventType := strings.TrimPrefix(html[match[2]:match[3]], "on")
+		gtmlCode := strings.TrimSpace(html[match[4]:match[5]])
+		if err := checkScopeFunctionNames(gtmlCode); err != nil {
+			return "", "", err
+		}
+
+		compiledScript, used := CompileGtmlScript(gtmlCode)
+		for sigName := range used {
+			signals[sigName] = true
+		}
+
+		// Handlers inside reactive lists can read the item they were rendered for
+		for _, itemName := range listVarsAt(html, match[0]) {
+			compiledScript = fmt.Sprintf("const %s = _gtmlLoopValue(this, '%s');\n    %s", itemName, itemName, compiledScript)
+		}
+
+		// The handler is bound from the instance script, the element only keeps a key
+		inlineEventCounter++
+		key := strconv.Itoa(inlineEventCounter)
+		bindings.WriteString(fmt.Sprintf("  _s.bindEvent('%s', '%s', function(event) {\n    %s\n  });\n", eventType, key, compiledScript))
+
+		result.WriteString(html[last:match[0]])
+		result.WriteString(fmt.Sprintf(" data-gtml-on-%s='%s'", eventType, key))
+		last = match[1]
+	}
+	result.WriteString(html[last:])
+
+	html = replaceSignalPlaceholders(result.String(), signals, instanceID)
+	return html, buildInstanceScript(instanceID, signalInitCode(signals, props)+bindings.String()), nil
 }
 
-function initSignal(name, value) {
-  if (!_gtmlSignalStore.has(name)) {
-    _gtmlSignalStore.set(name, new GtmlSignal(value));
-  }
+// bindingCounter is used to generate unique keys for reactive attribute and text bindings
+var bindingCounter int
+
+// ProcessSignalBindings compiles signal expressions in attribute values and text,
+// such as class='item {$isOpen ? "open" : ""}' or {$count + 1}, into bindings that
+// the runtime re-evaluates whenever the signals they read change. Simple {$name}
+// reads become signal value placeholders.
+func ProcessSignalBindings(html string, props map[string]Value, instanceID string) (string, string, error) {
+	if !strings.Contains(html, "{$") && !reListForAttr.MatchString(html) && !reSignalIf.MatchString(html) {
+		return html, "", nil
+	}
+
+	signals := make(map[string]bool)
+	var bindings strings.Builder
+	var result strings.Builder
+	i := 0
+	for i < len(html) {
+		if html[i] == '<' && i+1 < len(html) && html[i+1] >= 'a' && html[i+1] <= 'z' {
+			end := findTagEnd(html, i)
+			if end == -1 {
+				result.WriteString(html[i:])
+				break
+			}
+			if m := reListFor.FindStringSubmatch(ParseAttributes(html[i : end+1])["for"]); m != nil {
+				listEnd, err := bindList(html, i, m[1], m[2], props, signals, &bindings, &result)
+				if err != nil {
+					return "", "", err
+				}
+				i = listEnd
+				continue
+			}
+
+			tag, err := bindTagAttributes(html[i:end+1], props, signals, &bindings)
+			if err != nil {
+				return "", "", err
+			}
+			result.WriteString(tag)
+			i = end + 1
+
+			// Script and style contents are never bound
+			tagName := strings.ToLower(reTagName.FindString(tag[1:]))
+			if tagName == "script" || tagName == "style" {
+				closeIdx := strings.Index(strings.ToLower(html[i:]), "</"+tagName)
+				if closeIdx == -1 {
+					result.WriteString(html[i:])
+					break
+				}
+				result.WriteString(html[i : i+closeIdx])
+				i += closeIdx
+			}
+			continue
+		}
+
+		if strings.HasPrefix(html[i:], "{$") {
+			end := findMatchingBrace(html, i)
+			if end != -1 {
+				expr := strings.TrimSpace(html[i+1 : end])
+				if name := strings.TrimPrefix(expr, "$"); reIdentifier.MatchString(name) {
+					signals[name] = true
+					result.WriteString(fmt.Sprintf("<span data-gtml-signal-value='%s'></span>", signalKey(instanceID, name)))
+				} else {
+					bindingCounter++
+					key := strconv.Itoa(bindingCounter)
+					bindings.WriteString(fmt.Sprintf("  _s.bindText('%s', () => (%s));\n", key, compileGtmlCode(expr, signals)))
+					result.WriteString(fmt.Sprintf("<span data-gtml-bind='%s'></span>", key))
+				}
+				i = end + 1
+				continue
+			}
+		}
+
+		result.WriteByte(html[i])
+		i++
+	}
+
+	script := ""
+	if len(signals) > 0 {
+		script = buildInstanceScript(instanceID, signalInitCode(signals, props)+bindings.String())
+	}
+	return result.String(), script, nil
 }
 
-function _gtmlPropValue(propName) {
-  const el = document.currentScript.previousElementSibling;
-  if (el && el.hasAttribute('data-gtml-prop-' + propName)) {
-    const value = el.getAttribute('data-gtml-prop-' + propName);
-    if (value === 'null') return null;
-    if (value === 'undefined') return undefined;
-    if (value === 'true') return true;
-    if (value === 'false') return false;
-    if (!isNaN(value) && value !== '') return Number(value);
-    return value;
-  }
-  return null;
+// bindList replaces the element at start, which has a for='item in $items' attribute,
+// with an anchor the runtime renders one copy of the element after per array item.
+// It returns the index just past the element.
+func bindList(html string, start int, itemName string, sigName string, props map[string]Value, signals map[string]bool, bindings *strings.Builder, result *strings.Builder) (int, error) {
+	startIdx, endIdx, tagName, _, _, _ := findElementAt(html, start)
+	if startIdx == -1 {
+		return 0, fmt.Errorf("could not find the end of <%s> looping over $%s", tagName, sigName)
+	}
+	element := html[startIdx:endIdx]
+
+	keyPath := "null"
+	if m := reListKeyAttr.FindStringSubmatch(element[:findTagEnd(element, 0)+1]); m != nil {
+		keyAttr := m[1]
+		path := strings.TrimSpace(strings.Trim(keyAttr[1:len(keyAttr)-1], "{}"))
+		if path != itemName && !strings.HasPrefix(path, itemName+".") {
+			return 0, fmt.Errorf("key '%s' must be %s or a field of %s", keyAttr, itemName, itemName)
+		}
+		encoded, _ := json.Marshal(strings.TrimPrefix(strings.TrimPrefix(path, itemName), "."))
+		keyPath = string(encoded)
+	}
+
+	// Strip the loop attributes and resolve expressions that don't use the item at compile time.
+	// Plain {item.field} reads are filled by the runtime, other expressions on the item or
+	// on signals are compiled to functions of the item and filled in as {#index}.
+	source := reListLoopAttrs.ReplaceAllString(element, "")
+	var exprs []string
+	var filled strings.Builder
+	last := 0
+	for _, loc := range reExpression.FindAllStringIndex(source, -1) {
+		expr := strings.TrimSpace(source[loc[0]+1 : loc[1]-1])
+		isIf := reListIfAttr.MatchString(source[:loc[0]])
+		replacement := source[loc[0]:loc[1]]
+		switch {
+		case !isIf && reListItemPath.MatchString(expr) && reTagName.FindString(expr) == itemName:
+		case reSignalAccess.MatchString(expr) || readsListVar(expr, []string{itemName}):
+			if strings.Contains(expr, "(<") {
+				return 0, fmt.Errorf("expression '%s' in <%s> looping over $%s can't render markup, use if={...} on an element instead", expr, tagName, sigName)
+			}
+			code := compileGtmlCode(expr, signals)
+			if isIf {
+				code = "!!(" + code + ")"
+			}
+			exprs = append(exprs, fmt.Sprintf("(%s) => (%s)", itemName, code))
+			replacement = fmt.Sprintf("{#%d}", len(exprs)-1)
+		default:
+			if v, err := EvaluateExpression(expr, props); err == nil {
+				replacement = v.String()
+			}
+		}
+		// Conditional elements are dropped from the rendered item while their condition is false
+		if isIf {
+			filled.WriteString(reListIfAttr.ReplaceAllString(source[last:loc[0]], " data-gtml-if='"))
+			filled.WriteString(replacement + "'")
+		} else {
+			filled.WriteString(source[last:loc[0]] + replacement)
+		}
+		last = loc[1]
+	}
+	filled.WriteString(source[last:])
+	encodedSource, _ := json.Marshal(filled.String())
+
+	bindingCounter++
+	key := strconv.Itoa(bindingCounter)
+	signals[sigName] = true
+	bindings.WriteString(fmt.Sprintf("  _s.bindList('%s', '%s', '%s', %s, %s, [%s]);\n", key, itemName, sigName, keyPath, encodedSource, strings.Join(exprs, ", ")))
+	result.WriteString(fmt.Sprintf("<template data-gtml-list='%s'></template>", key))
+	return endIdx, nil
 }
 
-function _gtmlRenderSignalValues() {
-  document.querySelectorAll('[data-gtml-signal-value]').forEach(el => {
-    const name = el.getAttribute('data-gtml-signal-value');
-    const signal = getSignal(name);
-    const unsubscribe = signal.subscribe((newVal) => {
-      el.textContent = newVal;
-    });
-    el.textContent = signal.value;
-  });
+var (
+	reListItemPath = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+	reListIfAttr   = regexp.MustCompile(`\sif=$`)
+)
+
+// readsListVar reports whether a gtml expression reads one of the given loop item names
+func readsListVar(expr string, names []string) bool {
+	toks := tokenizeGtmlScript(expr)
+	for i, tok := range toks {
+		if tok.kind == jsIdent && slices.Contains(names, tok.text) && !isJSMember(toks, i) {
+			return true
+		}
+	}
+	return false
 }
-`
 
-func ProcessInlineEvents(html string, props map[string]Value) (string, string, error) {
-	matches := reInlineGtmlEvent.FindAllStringSubmatchIndex(html, -1)
+// listVarsAt returns the item variables of the reactive lists enclosing pos
+func listVarsAt(html string, pos int) []string {
+	var vars []string
+	for _, loc := range reListForAttr.FindAllStringSubmatchIndex(html[:pos], -1) {
+		tagStart := strings.LastIndex(html[:loc[0]], "<")
+		if tagStart == -1 {
+			continue
+		}
+		if _, endIdx, _, _, _, _ := findElementAt(html, tagStart); endIdx > pos {
+			vars = append(vars, html[loc[2]:loc[3]])
+		}
+	}
+	return vars
+}
 
-	if len(matches) == 0 {
-		return html, "", nil
+// bindTagAttributes replaces attribute values containing signal expressions with
+// their static text and records a binding that keeps the attribute up to date.
+// bind:value and bind:checked directives become two-way input bindings.
+func bindTagAttributes(tag string, props map[string]Value, signals map[string]bool, bindings *strings.Builder) (string, error) {
+	if !strings.Contains(tag, "{$") && !reSignalIf.MatchString(tag) {
+		return tag, nil
 	}
 
-	signalRegistrations := make(map[string]bool)
-	propSignals := make(map[string]bool)
-	declaredSignals := make(map[string]bool)
+	nameEnd := 1 + len(reTagName.FindString(tag[1:]))
+	var result strings.Builder
+	result.WriteString(tag[:nameEnd])
+	key := ""
+	hidden := false
 
-	for _, match := range matches {
-		eventName := html[match[2]:match[3]]
-		eventStart := match[0]
-		eventEnd := match[1]
+	i := nameEnd
+	for i < len(tag) {
+		start := i
+		for i < len(tag) && unicode.IsSpace(rune(tag[i])) {
+			i++
+		}
+		nameStart := i
+		for i < len(tag) && !unicode.IsSpace(rune(tag[i])) && !strings.ContainsRune("=>/", rune(tag[i])) {
+			i++
+		}
+		name := tag[nameStart:i]
+		if name == "" || i >= len(tag) || tag[i] != '=' {
+			if name == "" {
+				i = max(i, start+1)
+			}
+			result.WriteString(tag[start:i])
+			continue
+		}
 
-		gtmlCode := strings.TrimSpace(html[match[4]:match[5]])
+		i++
+		valueStart := i
+		quote := byte(0)
+		switch {
+		case tag[i] == '\'' || tag[i] == '"':
+			quote = tag[i]
+			closeIdx := strings.IndexByte(tag[i+1:], quote)
+			if closeIdx == -1 {
+				result.WriteString(tag[start:])
+				return result.String(), nil
+			}
+			i += closeIdx + 2
+		case tag[i] == '{':
+			closeIdx := findMatchingBrace(tag, i)
+			if closeIdx == -1 {
+				result.WriteString(tag[start:])
+				return result.String(), nil
+			}
+			i = closeIdx + 1
+		default:
+			for i < len(tag) && !unicode.IsSpace(rune(tag[i])) && tag[i] != '>' {
+				i++
+			}
+		}
 
-		declaredInScript := extractDeclaredSignals(gtmlCode)
-		for _, sigName := range declaredInScript {
-			declaredSignals[sigName] = true
-			propSignals[sigName] = false
+		value := tag[valueStart:i]
+		if quote != 0 {
+			value = value[1 : len(value)-1]
+		}
+		isSignalIf := name == "if" && strings.HasPrefix(value, "{") && reSignalAccess.MatchString(value)
+		// Fetch urls and form actions read their signals in the fetch script
+		if (!strings.Contains(value, "{$") && !isSignalIf) || name == "fetch" || (name == "action" && reFormMethod.MatchString(value)) {
+			result.WriteString(tag[start:i])
+			continue
 		}
 
-		compiledScript, signals := CompileGtmlScript(gtmlCode)
+		if key == "" {
+			bindingCounter++
+			key = strconv.Itoa(bindingCounter)
+		}
 
-		for sigName := range signals {
-			if !signalRegistrations[sigName] {
-				signalRegistrations[sigName] = true
+		// Conditional elements start out not displayed and are attached or detached by the runtime
+		if isSignalIf {
+			if findMatchingBrace(value, 0) != len(value)-1 {
+				return "", fmt.Errorf("if must be a single expression like {$open}, got '%s'", value)
 			}
+			bindings.WriteString(fmt.Sprintf("  _s.bindIf('%s', () => (%s));\n", key, compileGtmlCode(strings.TrimSpace(value[1:len(value)-1]), signals)))
+			hidden = true
+			continue
 		}
 
-		currentPropSignals := extractPropSignals(gtmlCode)
-		for sigName := range currentPropSignals {
-			if !propSignals[sigName] {
-				propSignals[sigName] = true
+		if strings.HasPrefix(name, "bind:") {
+			property := strings.TrimPrefix(name, "bind:")
+			if property != "value" && property != "checked" {
+				return "", fmt.Errorf("unsupported binding '%s', expected bind:value or bind:checked", name)
+			}
+			sigName := strings.TrimPrefix(strings.TrimSpace(strings.Trim(value, "{}")), "$")
+			if !strings.HasPrefix(strings.TrimSpace(value), "{$") || !reIdentifier.MatchString(sigName) {
+				return "", fmt.Errorf("%s must reference a single signal like {$name}, got '%s'", name, value)
 			}
+			signals[sigName] = true
+			bindings.WriteString(fmt.Sprintf("  _s.bindInput('%s', '%s', '%s');\n", key, property, sigName))
+			continue
 		}
 
-		eventHandler := fmt.Sprintf(" %s=\"function() { %s }\"", eventName, compiledScript)
-		// Escape braces to prevent expression regex from matching
-		eventHandler = strings.ReplaceAll(eventHandler, "{", "&#123;")
-		eventHandler = strings.ReplaceAll(eventHandler, "}", "&#125;")
-		html = html[:eventStart] + eventHandler + html[eventEnd:]
+		staticValue, jsFn := compileAttributeBinding(value, props, signals)
+		bindings.WriteString(fmt.Sprintf("  _s.bindAttr('%s', '%s', %s);\n", key, name, jsFn))
+
+		// A value that is a single expression is left for the runtime to set
+		if staticValue != "" {
+			q := string(quote)
+			if quote == 0 {
+				q = "'"
+			}
+			result.WriteString(tag[start:nameStart] + name + "=" + q + staticValue + q)
+		}
 	}
 
-	signalInitCode := ""
-	for sigName := range signalRegistrations {
-		if propSignals[sigName] {
-			if propVal, ok := props[sigName]; ok {
-				var jsValue string
-				switch propVal.Type {
-				case PropTypeString:
-					jsValue = fmt.Sprintf("'%s'", propVal.StrVal)
-				case PropTypeInt:
-					jsValue = fmt.Sprintf("%d", propVal.IntVal)
-				case PropTypeBoolean:
-					if propVal.BoolVal {
-						jsValue = "true"
-					} else {
-						jsValue = "false"
-					}
-				default:
-					jsValue = "null"
-				}
-				signalInitCode += fmt.Sprintf("  initSignal('%s', %s);\n", sigName, jsValue)
+	if key == "" {
+		return result.String(), nil
+	}
+	out := result.String()
+	attrs := fmt.Sprintf(" data-gtml-bind='%s'", key)
+	// Conditional elements start with an inline display: none, since hidden loses to any
+	// display the element sets. The runtime restores their own style when they are shown.
+	if hidden {
+		attrs += " style='display: none'"
+		if loc := reStyleAttrValue.FindStringSubmatchIndex(out); loc != nil {
+			attrs += " data-gtml-style=" + out[loc[2]:loc[3]]
+			out = out[:loc[0]] + out[loc[1]:]
+		}
+	}
+	return out[:nameEnd] + attrs + out[nameEnd:], nil
+}
+
+// reStyleAttrValue matches a quoted style attribute
+var reStyleAttrValue = regexp.MustCompile(`\sstyle\s*=\s*('[^']*'|"[^"]*")`)
+
+// compileAttributeBinding splits an attribute value into its static text, used as
+// the initial value, and a JavaScript function computing the full value
+func compileAttributeBinding(value string, props map[string]Value, signals map[string]bool) (string, string) {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") && findMatchingBrace(trimmed, 0) == len(trimmed)-1 {
+		return "", fmt.Sprintf("() => (%s)", compileGtmlCode(strings.TrimSpace(trimmed[1:len(trimmed)-1]), signals))
+	}
+
+	var staticParts []string
+	var template strings.Builder
+	template.WriteString("() => `")
+	i := 0
+	for i < len(value) {
+		end := -1
+		if value[i] == '{' {
+			end = findMatchingBrace(value, i)
+		}
+		if end == -1 {
+			next := strings.IndexByte(value[i+1:], '{')
+			if next == -1 {
+				next = len(value)
 			} else {
-				signalInitCode += fmt.Sprintf("  initSignal('%s', null);\n", sigName)
+				next += i + 1
 			}
+			staticParts = append(staticParts, value[i:next])
+			template.WriteString(escapeTemplateLiteral(value[i:next]))
+			i = next
+			continue
+		}
+
+		expr := strings.TrimSpace(value[i+1 : end])
+		if strings.Contains(expr, "$") {
+			template.WriteString(fmt.Sprintf("${(%s) ?? ''}", compileGtmlCode(expr, signals)))
+		} else if v, err := EvaluateExpression(expr, props); err == nil {
+			// Plain prop expressions are still resolved at compile time
+			staticParts = append(staticParts, v.String())
+			template.WriteString(escapeTemplateLiteral(v.String()))
 		} else {
-			signalInitCode += fmt.Sprintf("  initSignal('%s', null);\n", sigName)
+			staticParts = append(staticParts, value[i:end+1])
+			template.WriteString(escapeTemplateLiteral(value[i : end+1]))
 		}
+		i = end + 1
 	}
+	template.WriteString("`")
+
+	return strings.Join(strings.Fields(strings.Join(staticParts, "")), " "), template.String()
+}
 
-	return html, signalInitCode, nil
+func escapeTemplateLiteral(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "`", "\\`")
+	return strings.ReplaceAll(s, "${", "\\${")
 }
 
-func ProcessGtmlScripts(html string, props map[string]Value) (string, string, error) {
-	matches := reGtmlScript.FindAllStringSubmatchIndex(html, -1)
+func ProcessGtmlScripts(html string, props map[string]Value, instanceID string) (string, string, error) {
+	matches := reGtmlScript.FindAllStringSubmatch(html, -1)
 
 	if len(matches) == 0 {
 		return html, "", nil
 	}
 
-	signalRegistrations := make(map[string]bool)
+	signals := make(map[string]bool)
 	var compiledScripts strings.Builder
-	var declaredSignals []string
-	propSignals := make(map[string]bool)
 
 	for _, match := range matches {
-		scriptStart := match[2]
-		scriptEnd := match[3]
-		gtmlCode := html[scriptStart:scriptEnd]
-
-		declaredSignals = extractDeclaredSignals(gtmlCode)
-		compiledScript, signals := CompileGtmlScript(gtmlCode)
-
-		for sigName := range signals {
-			if !signalRegistrations[sigName] {
-				signalRegistrations[sigName] = true
-			}
-		}
-
-		for _, sigName := range declaredSignals {
-			propSignals[sigName] = false
+		if err := checkScopeFunctionNames(match[1]); err != nil {
+			return "", "", err
 		}
-
-		currentPropSignals := extractPropSignals(gtmlCode)
-		for sigName := range currentPropSignals {
-			if !propSignals[sigName] {
-				propSignals[sigName] = true
-			}
-		}
-
-		compiledScripts.WriteString(compiledScript)
-	}
-
-	signalInitCode := ""
-	for sigName := range signalRegistrations {
-		if propSignals[sigName] {
-			// Use actual prop value if available, otherwise null
-			if propVal, ok := props[sigName]; ok {
-				// Format value appropriately for JavaScript
-				var jsValue string
-				switch propVal.Type {
-				case PropTypeString:
-					jsValue = fmt.Sprintf("'%s'", propVal.StrVal)
-				case PropTypeInt:
-					jsValue = fmt.Sprintf("%d", propVal.IntVal)
-				case PropTypeBoolean:
-					if propVal.BoolVal {
-						jsValue = "true"
-					} else {
-						jsValue = "false"
-					}
-				default:
-					jsValue = "null"
-				}
-				signalInitCode += fmt.Sprintf("  initSignal('%s', %s);\n", sigName, jsValue)
-			} else {
-				signalInitCode += fmt.Sprintf("  initSignal('%s', null);\n", sigName)
-			}
-		} else {
-			signalInitCode += fmt.Sprintf("  initSignal('%s', null);\n", sigName)
+		compiledScript, used := CompileGtmlScript(match[1])
+		for sigName := range used {
+			signals[sigName] = true
 		}
+		compiledScripts.WriteString("  " + compiledScript + "\n")
 	}
 
-	if signalInitCode != "" {
-		signalInitCode = "\n" + signalInitCode
-	}
-
-	headerScript := fmt.Sprintf("\n<script>\n%s\n(function() {%s\n  _gtmlRenderSignalValues();\n})();\n</script>\n",
-		signalInitCode, compiledScripts.String())
-
 	result := reGtmlScript.ReplaceAllString(html, "")
+	result = replaceSignalPlaceholders(result, signals, instanceID)
 
-	for sigName := range signalRegistrations {
-		signalRe := regexp.MustCompile(`\{` + sigName + `\}`)
-		result = signalRe.ReplaceAllString(result, fmt.Sprintf("<span data-gtml-signal-value='%s'></span>", sigName))
-	}
-
-	return result, headerScript, nil
+	return result, buildInstanceScript(instanceID, signalInitCode(signals, props)+compiledScripts.String()), nil
 }
 
 func CompileGtmlScript(gtmlCode string) (string, map[string]bool) {
 	signals := make(map[string]bool)
+	return strings.TrimSpace(compileGtmlCode(gtmlCode, signals)), signals
+}
 
-	code := gtmlCode
+// jsTokenKind classifies the tokens of a gtml script
+type jsTokenKind int
 
-	code = convertElementSelectors(code, signals)
-	code = convertEventBindings(code)
-	code = convertSignalOperations(code, signals)
-	code = convertSignalAccess(code, signals)
+const (
+	jsSpace jsTokenKind = iota
+	jsComment
+	jsString
+	jsTemplate
+	jsRegex
+	jsNumber
+	jsIdent
+	jsSignal
+	jsSelector
+	jsPunct
+)
 
-	return strings.TrimSpace(code), signals
+type jsToken struct {
+	kind jsTokenKind
+	text string
 }
 
-// convertEventBindings converts .onclick(function() {...}) to .onclick = function() {...};
-func convertEventBindings(code string) string {
-	// Pattern to match event bindings like .onclick(function() or .onclick(function ()
-	reEventBinding := regexp.MustCompile(`\.(on[a-z]+)\(function\s*\(\s*\)\s*\{`)
-	code = reEventBinding.ReplaceAllString(code, ".$1 = function() {")
+// jsPunctuators lists multi-character operators, longest first. := is gtml's computed signal operator.
+var jsPunctuators = []string{"**=", "===", "!==", "...", "=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--", "+=", "-=", "*=", "/=", "%=", "**", ":="}
 
-	// Convert closing }); to }; for event bindings (with semicolon)
-	reClosingParenSemi := regexp.MustCompile(`\}\);`)
-	code = reClosingParenSemi.ReplaceAllString(code, "};")
+// compileGtmlCode rewrites gtml syntax in JavaScript code into calls on the instance scope _s:
+// $x reads and assignments, #id and .class lookups, .onclick(fn) bindings and effect(fn).
+// Strings, comments, regular expressions and template literal text are never rewritten.
+func compileGtmlCode(code string, signals map[string]bool) string {
+	return compileJSTokens(tokenizeGtmlScript(code), signals)
+}
 
-	// Convert closing }) to }; for event bindings (without semicolon)
-	// This handles the closing parenthesis from the original .onclick(function(){}) syntax
-	reClosingParen := regexp.MustCompile(`\}\)(\s*)$`)
-	code = reClosingParen.ReplaceAllString(code, "};$1")
+func tokenizeGtmlScript(code string) []jsToken {
+	var tokens []jsToken
+	prevSig := -1
+	add := func(kind jsTokenKind, text string) {
+		tokens = append(tokens, jsToken{kind, text})
+		if kind != jsSpace && kind != jsComment {
+			prevSig = len(tokens) - 1
+		}
+	}
+	afterDot := func() bool {
+		return prevSig != -1 && tokens[prevSig].kind == jsPunct && (tokens[prevSig].text == "." || tokens[prevSig].text == "?.")
+	}
+	afterExpr := func() bool {
+		return prevSig != -1 && isJSExprEnd(tokens[prevSig])
+	}
 
-	// Handle }) followed by newlines and more code
-	reClosingParenMidCode := regexp.MustCompile(`\}\)(\s*\n)`)
-	code = reClosingParenMidCode.ReplaceAllString(code, "};$1")
+	i := 0
+	for i < len(code) {
+		c := code[i]
+		start := i
+		switch {
+		case unicode.IsSpace(rune(c)):
+			for i < len(code) && unicode.IsSpace(rune(code[i])) {
+				i++
+			}
+			add(jsSpace, code[start:i])
+		case strings.HasPrefix(code[i:], "//"):
+			end := strings.IndexByte(code[i:], '\n')
+			if end == -1 {
+				end = len(code) - i
+			}
+			i += end
+			add(jsComment, code[start:i])
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end == -1 {
+				i = len(code)
+			} else {
+				i += end + 4
+			}
+			add(jsComment, code[start:i])
+		case c == '\'' || c == '"':
+			i = skipQuoted(code, i)
+			add(jsString, code[start:i])
+		case c == '`':
+			i = skipQuoted(code, i)
+			add(jsTemplate, code[start:i])
+		case c == '/' && !afterExpr():
+			i = skipJSRegex(code, i)
+			add(jsRegex, code[start:i])
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(code) && code[i+1] >= '0' && code[i+1] <= '9':
+			for i < len(code) && (isIdentByte(code[i]) || code[i] == '.') {
+				i++
+			}
+			add(jsNumber, code[start:i])
+		case c == '$' && i+1 < len(code) && isSignalNameStart(code[i+1]) && !afterDot():
+			i++
+			for i < len(code) && isSignalNameStart(code[i]) || i < len(code) && code[i] >= '0' && code[i] <= '9' {
+				i++
+			}
+			add(jsSignal, code[start:i])
+		case isIdentByte(c) || c == '#' && afterDot():
+			i++
+			for i < len(code) && isIdentByte(code[i]) {
+				i++
+			}
+			add(jsIdent, code[start:i])
+		case c == '#' || c == '.' && !afterExpr() && i+1 < len(code) && isSignalNameStart(code[i+1]):
+			i++
+			for i < len(code) && (isIdentByte(code[i]) && code[i] != '$' || code[i] == '-') {
+				i++
+			}
+			if i < len(code) && code[i] == '*' && i > start+1 {
+				i++
+			}
+			add(jsSelector, code[start:i])
+		default:
+			punct := string(c)
+			for _, p := range jsPunctuators {
+				if strings.HasPrefix(code[i:], p) {
+					punct = p
+					break
+				}
+			}
+			i += len(punct)
+			add(jsPunct, punct)
+		}
+	}
+	return tokens
+}
 
-	return code
+func isSignalNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
 
-func convertElementSelectors(code string, signals map[string]bool) string {
-	reElementSel = regexp.MustCompile(`(^|[(\s;,])#([a-zA-Z_-][a-zA-Z0-9_-]*)(\*?)($|[)\s.,;])`)
-	code = reElementSel.ReplaceAllStringFunc(code, func(match string) string {
-		submatch := reElementSel.FindStringSubmatch(match)
-		if len(submatch) < 5 {
-			return match
+// isJSExprEnd reports whether a token can end an expression, which decides
+// whether a following / is division and a following . is member access
+func isJSExprEnd(tok jsToken) bool {
+	switch tok.kind {
+	case jsNumber, jsString, jsTemplate, jsRegex, jsSignal, jsSelector:
+		return true
+	case jsIdent:
+		switch tok.text {
+		case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else", "yield", "await":
+			return false
 		}
-		prefix := submatch[1]
-		id := submatch[2]
-		isAll := submatch[3] == "*"
-		suffix := submatch[4]
-		selector := fmt.Sprintf("document.querySelector%s('#%s')", map[bool]string{true: "All", false: ""}[isAll], id)
-		return prefix + selector + suffix
-	})
+		return true
+	case jsPunct:
+		return tok.text == ")" || tok.text == "]"
+	}
+	return false
+}
 
-	reClassSel = regexp.MustCompile(`(^|[(\s;,])\.([a-zA-Z_-][a-zA-Z0-9_-]*)(\*?)($|[)\s.,;])`)
-	code = reClassSel.ReplaceAllStringFunc(code, func(match string) string {
-		submatch := reClassSel.FindStringSubmatch(match)
-		if len(submatch) < 5 {
-			return match
+func compileJSTokens(toks []jsToken, signals map[string]bool) string {
+	var out strings.Builder
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch tok.kind {
+		case jsTemplate:
+			out.WriteString(compileTemplateLiteral(tok.text, signals))
+		case jsSelector:
+			out.WriteString(compileSelector(tok.text))
+		case jsSignal:
+			name := tok.text[1:]
+			signals[name] = true
+			op := ""
+			next := nextJSToken(toks, i+1)
+			if next != -1 && toks[next].kind == jsPunct {
+				op = toks[next].text
+			}
+			switch op {
+			case "=", ":=", "+=", "-=", "*=", "/=", "%=":
+				end := findJSExprEnd(toks, next+1)
+				value := strings.TrimSpace(compileJSTokens(toks[next+1:end], signals))
+				open, close := persistCallArgs(toks[next+1 : end])
+				switch {
+				case op == "=" && open != -1:
+					// $name = persist(initial) hydrates the signal from storage and writes it back on change
+					args := strings.TrimSpace(compileJSTokens(toks[next+1+open+1:next+1+close], signals))
+					out.WriteString(fmt.Sprintf("_s.persist('%s', %s)", name, args))
+				case op == "=":
+					out.WriteString(fmt.Sprintf("_s.set('%s', %s)", name, value))
+				case op == ":=":
+					out.WriteString(fmt.Sprintf("_s.computed('%s', () => (%s))", name, value))
+				default:
+					out.WriteString(fmt.Sprintf("_s.set('%s', _s.get('%s') %s (%s))", name, name, op[:1], value))
+				}
+				i = end - 1
+			case "++", "--":
+				out.WriteString(fmt.Sprintf("_s.set('%s', _s.get('%s') %s 1)", name, name, op[:1]))
+				i = next
+			case ".":
+				// In-place array methods like $items.push(x) notify the signal's subscribers
+				method := nextJSToken(toks, next+1)
+				open := -1
+				if method != -1 && arrayMutators[toks[method].text] {
+					open = nextJSToken(toks, method+1)
+				}
+				if open == -1 || toks[open].text != "(" || findJSClose(toks, open) == -1 {
+					out.WriteString(fmt.Sprintf("_s.get('%s')", name))
+					break
+				}
+				close := findJSClose(toks, open)
+				args := compileJSTokens(toks[open+1:close], signals)
+				out.WriteString(fmt.Sprintf("_s.mutate('%s', v => v.%s(%s))", name, toks[method].text, args))
+				i = close
+			default:
+				out.WriteString(fmt.Sprintf("_s.get('%s')", name))
+			}
+		case jsIdent:
+			next := nextJSToken(toks, i+1)
+			if scopeFunctions[tok.text] && !isJSMember(toks, i) && next != -1 && toks[next].text == "(" {
+				out.WriteString("_s." + tok.text)
+			} else {
+				out.WriteString(tok.text)
+			}
+		case jsPunct:
+			// .onclick(handler) becomes .onclick = handler;
+			if tok.text == "." && i+2 < len(toks) && toks[i+1].kind == jsIdent && domEventProps[toks[i+1].text] && toks[i+2].text == "(" {
+				if close := findJSClose(toks, i+2); close != -1 {
+					handler := strings.TrimSpace(compileJSTokens(toks[i+3:close], signals))
+					out.WriteString(fmt.Sprintf(".%s = %s;", toks[i+1].text, handler))
+					i = close
+					if i+1 < len(toks) && toks[i+1].text == ";" {
+						i++
+					}
+					continue
+				}
+			}
+			out.WriteString(tok.text)
+		default:
+			out.WriteString(tok.text)
 		}
-		prefix := submatch[1]
-		class := submatch[2]
-		isAll := submatch[3] == "*"
-		suffix := submatch[4]
-		selector := fmt.Sprintf("document.querySelector%s('.%s')", map[bool]string{true: "All", false: ""}[isAll], class)
-		return prefix + selector + suffix
-	})
+	}
+	return out.String()
+}
 
-	return code
+// persistCallArgs returns the indexes of the parentheses when toks is exactly
+// a persist(...) call, or -1, -1 otherwise
+func persistCallArgs(toks []jsToken) (int, int) {
+	first := nextJSToken(toks, 0)
+	if first == -1 || toks[first].text != "persist" {
+		return -1, -1
+	}
+	open := nextJSToken(toks, first+1)
+	if open == -1 || toks[open].text != "(" {
+		return -1, -1
+	}
+	close := findJSClose(toks, open)
+	if close == -1 || nextJSToken(toks, close+1) != -1 {
+		return -1, -1
+	}
+	return open, close
 }
 
-func convertSignalOperations(code string, signals map[string]bool) string {
-	code = reSignalSet.ReplaceAllStringFunc(code, func(match string) string {
-		submatch := reSignalSet.FindStringSubmatch(match)
-		if len(submatch) < 3 {
-			return match
+// compileTemplateLiteral compiles the ${...} substitutions of a template literal
+func compileTemplateLiteral(text string, signals map[string]bool) string {
+	var out strings.Builder
+	i := 0
+	for i < len(text) {
+		if text[i] == '\\' && i+1 < len(text) {
+			out.WriteString(text[i : i+2])
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(text[i:], "${") {
+			if end := findMatchingBrace(text, i+1); end != -1 {
+				out.WriteString("${" + compileGtmlCode(text[i+2:end], signals) + "}")
+				i = end + 1
+				continue
+			}
 		}
-		sigName := submatch[1]
-		rightSide := strings.TrimSpace(submatch[2])
-		signals[sigName] = true
+		out.WriteByte(text[i])
+		i++
+	}
+	return out.String()
+}
 
-		compiledRight := compileSignalExpression(rightSide, signals)
+// compileSelector converts #id, .class and their * variants into lookups relative
+// to the component instance. A bare # refers to the instance root.
+func compileSelector(selector string) string {
+	if selector == "#" {
+		return "_s.root"
+	}
+	if strings.HasSuffix(selector, "*") {
+		return fmt.Sprintf("_s.$$('%s')", strings.TrimSuffix(selector, "*"))
+	}
+	return fmt.Sprintf("_s.$('%s')", selector)
+}
 
-		return fmt.Sprintf("setSignal('%s', %s)", sigName, compiledRight)
-	})
+// findJSExprEnd returns the index of the token ending the expression that starts at start.
+// An expression ends at a ; or , or unmatched closing bracket, or at a line break
+// unless the line ends with an operator or the next line continues it.
+func findJSExprEnd(toks []jsToken, start int) int {
+	depth := 0
+	lastSig := start - 1
+	for k := start; k < len(toks); k++ {
+		t := toks[k]
+		switch {
+		case t.kind == jsPunct && (t.text == "(" || t.text == "[" || t.text == "{"):
+			depth++
+		case t.kind == jsPunct && (t.text == ")" || t.text == "]" || t.text == "}"):
+			if depth == 0 {
+				return lastSig + 1
+			}
+			depth--
+		case depth == 0 && t.kind == jsPunct && (t.text == ";" || t.text == ","):
+			return lastSig + 1
+		case depth == 0 && t.kind == jsSpace && strings.Contains(t.text, "\n") && lastSig >= start:
+			next := nextJSToken(toks, k+1)
+			if !continuesJSLine(toks[lastSig]) && (next == -1 || !continuesJSExpr(toks[next])) {
+				return lastSig + 1
+			}
+		}
+		if t.kind != jsSpace && t.kind != jsComment {
+			lastSig = k
+		}
+	}
+	return lastSig + 1
+}
 
-	return code
+// continuesJSLine reports whether a line ending in tok must continue on the next line
+func continuesJSLine(tok jsToken) bool {
+	if tok.kind != jsPunct {
+		return false
+	}
+	switch tok.text {
+	case ")", "]", "}", "++", "--", ";":
+		return false
+	}
+	return true
 }
 
-func compileSignalExpression(expr string, signals map[string]bool) string {
-	processed := expr
+// continuesJSExpr reports whether a line starting with tok continues the previous expression
+func continuesJSExpr(tok jsToken) bool {
+	if tok.kind != jsPunct {
+		return false
+	}
+	switch tok.text {
+	case "(", "[", "{", "!", "~", "++", "--", ";", ")", "]", "}":
+		return false
+	}
+	return true
+}
 
-	reCompoundOp := regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)\s*([+\-*/%]|==|!=|<=|>=|<|>)\s*(.+)`)
-	processed = reCompoundOp.ReplaceAllStringFunc(processed, func(match string) string {
-		submatch := reCompoundOp.FindStringSubmatch(match)
-		if len(submatch) < 4 {
-			return match
+// findJSClose returns the index of the ) matching the ( at open
+func findJSClose(toks []jsToken, open int) int {
+	depth := 0
+	for k := open; k < len(toks); k++ {
+		if toks[k].kind != jsPunct {
+			continue
+		}
+		switch toks[k].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return k
+			}
 		}
-		sigName := submatch[1]
-		op := submatch[2]
-		rightSide := strings.TrimSpace(submatch[3])
-		signals[sigName] = true
+	}
+	return -1
+}
 
-		compiledRight := compileSignalExpression(rightSide, signals)
+// arrayMutators are the array methods that change an array signal in place
+var arrayMutators = map[string]bool{
+	"push": true, "pop": true, "shift": true, "unshift": true, "splice": true,
+	"sort": true, "reverse": true, "fill": true, "copyWithin": true,
+}
 
-		return fmt.Sprintf("(getSignal('%s').value %s %s)", sigName, op, compiledRight)
-	})
+// scopeFunctions are the gtml script functions that run against the instance scope
+var scopeFunctions = map[string]bool{"effect": true, "emit": true, "on": true, "refetch": true}
+
+// domEventProps are the event handler properties .onclick(fn) style bindings compile for.
+// Other .onxxx(...) calls, like emitter.once(fn), are ordinary method calls.
+var domEventProps = map[string]bool{
+	"onabort": true, "onanimationend": true, "onanimationiteration": true, "onanimationstart": true,
+	"onbeforeinput": true, "onblur": true, "oncancel": true, "oncanplay": true, "onchange": true,
+	"onclick": true, "onclose": true, "oncompositionend": true, "oncompositionstart": true,
+	"oncontextmenu": true, "oncopy": true, "oncut": true, "ondblclick": true, "ondrag": true,
+	"ondragend": true, "ondragenter": true, "ondragleave": true, "ondragover": true,
+	"ondragstart": true, "ondrop": true, "onended": true, "onerror": true, "onfocus": true,
+	"onfocusin": true, "onfocusout": true, "oninput": true, "oninvalid": true, "onkeydown": true,
+	"onkeypress": true, "onkeyup": true, "onload": true, "onloadeddata": true, "onmousedown": true,
+	"onmouseenter": true, "onmouseleave": true, "onmousemove": true, "onmouseout": true,
+	"onmouseover": true, "onmouseup": true, "onpaste": true, "onpause": true, "onplay": true,
+	"onpointercancel": true, "onpointerdown": true, "onpointerenter": true, "onpointerleave": true,
+	"onpointermove": true, "onpointerout": true, "onpointerover": true, "onpointerup": true,
+	"onreset": true, "onresize": true, "onscroll": true, "onselect": true, "onsubmit": true,
+	"ontimeupdate": true, "ontoggle": true, "ontouchcancel": true, "ontouchend": true,
+	"ontouchmove": true, "ontouchstart": true, "ontransitionend": true, "onvolumechange": true,
+	"onwheel": true,
+}
 
-	processed = reSignalAccess.ReplaceAllStringFunc(processed, func(match string) string {
-		submatch := reSignalAccess.FindStringSubmatch(match)
-		if len(submatch) < 2 {
-			return match
+// checkScopeFunctionNames rejects gtml code that declares a variable, function or
+// parameter named like a scope function, since calls to it would reach the scope's
+func checkScopeFunctionNames(code string) error {
+	toks := tokenizeGtmlScript(code)
+	for i, tok := range toks {
+		if tok.kind == jsIdent && scopeFunctions[tok.text] && !isJSMember(toks, i) && isJSBinding(toks, i) {
+			return fmt.Errorf("'%s' is reserved in gtml scripts, rename the %s declared in the script", tok.text, tok.text)
 		}
-		sigName := submatch[1]
-		signals[sigName] = true
-		return fmt.Sprintf("getSignal('%s').value", sigName)
-	})
-
-	return processed
+	}
+	return nil
 }
 
-func convertSignalAccess(code string, signals map[string]bool) string {
-	code = reSignalAccess.ReplaceAllStringFunc(code, func(match string) string {
-		submatch := reSignalAccess.FindStringSubmatch(match)
-		if len(submatch) < 2 {
-			return match
+// isJSBinding reports whether the identifier at i is declared there, as a variable,
+// function, class or parameter
+func isJSBinding(toks []jsToken, i int) bool {
+	if prev := prevJSToken(toks, i-1); prev != -1 {
+		switch toks[prev].text {
+		case "function", "const", "let", "var", "class":
+			return true
 		}
-		sigName := submatch[1]
-		signals[sigName] = true
-		return fmt.Sprintf("getSignal('%s').value", sigName)
-	})
-	return code
+	}
+	if next := nextJSToken(toks, i+1); next != -1 && (toks[next].text == "=>" || toks[next].text == "(") {
+		return toks[next].text == "=>"
+	}
+
+	// Inside a parameter list, the ( closes before => or follows function or catch
+	depth := 0
+	for k := i - 1; k >= 0; k-- {
+		switch toks[k].text {
+		case ")", "]", "}":
+			depth++
+		case "[", "{":
+			if depth > 0 {
+				depth--
+			}
+		case "(":
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if close := findJSClose(toks, k); close != -1 {
+				if next := nextJSToken(toks, close+1); next != -1 && toks[next].text == "=>" {
+					return true
+				}
+			}
+			prev := prevJSToken(toks, k-1)
+			if prev != -1 && toks[prev].kind == jsIdent && toks[prev].text != "function" && toks[prev].text != "catch" {
+				prev = prevJSToken(toks, prev-1)
+			}
+			return prev != -1 && (toks[prev].text == "function" || toks[prev].text == "catch")
+		}
+	}
+	return false
 }
 
-func extractSignalNames(script string) map[string]bool {
-	signals := make(map[string]bool)
-	reSignalUsage := regexp.MustCompile(`setSignal\('([a-zA-Z_][a-zA-Z0-9_]*)'`)
-	matches := reSignalUsage.FindAllStringSubmatchIndex(script, -1)
-	for _, match := range matches {
-		if len(match) >= 4 {
-			sigName := script[match[2]:match[3]]
-			signals[sigName] = true
+// isJSMember reports whether the token at i follows a . or ?.
+func isJSMember(toks []jsToken, i int) bool {
+	prev := prevJSToken(toks, i-1)
+	return prev != -1 && toks[prev].kind == jsPunct && (toks[prev].text == "." || toks[prev].text == "?.")
+}
+
+func nextJSToken(toks []jsToken, from int) int {
+	for k := from; k < len(toks); k++ {
+		if toks[k].kind != jsSpace && toks[k].kind != jsComment {
+			return k
 		}
 	}
-	return signals
+	return -1
 }
 
-func extractPropSignals(script string) map[string]bool {
-	propSignals := make(map[string]bool)
-	signals := extractSignalNames(script)
-	reSignalAccess := regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
-	matches := reSignalAccess.FindAllStringSubmatch(script, -1)
-	for _, match := range matches {
-		if len(match) >= 2 {
-			sigName := match[1]
-			if !signals[sigName] && sigName != "this" {
-				propSignals[sigName] = true
-			}
+func prevJSToken(toks []jsToken, from int) int {
+	for k := from; k >= 0; k-- {
+		if toks[k].kind != jsSpace && toks[k].kind != jsComment {
+			return k
 		}
 	}
-	return propSignals
+	return -1
 }
 
-func extractDeclaredSignals(script string) []string {
-	var declared []string
-	re := regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)\s*=`)
-	matches := re.FindAllStringSubmatch(script, -1)
-	for _, match := range matches {
-		if len(match) >= 2 {
-			sigName := match[1]
-			declared = append(declared, sigName)
+// findMatchingBrace returns the index of the } closing the { at start, skipping string literals
+func findMatchingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'', '`':
+			i = skipQuoted(s, i) - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
 		}
 	}
-	return declared
+	return -1
 }
+
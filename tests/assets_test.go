@@ -0,0 +1,347 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/gtml/pkg/gtml"
+)
+
+func writeTestProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, d := range []string{"components", "routes", "static"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testCompileOptions() gtml.CompileOptions {
+	return gtml.CompileOptions{
+		ComponentsDir: "components",
+		RoutesDir:     "routes",
+		DistDir:       "dist",
+		StaticDir:     "static",
+	}
+}
+
+func TestFingerprintPath(t *testing.T) {
+	result := gtml.FingerprintPath("img/logo.png", []byte("logo"))
+	if !strings.HasPrefix(result, "img/logo.") || !strings.HasSuffix(result, ".png") {
+		t.Errorf("expected hash inserted before extension, got %q", result)
+	}
+	if len(result) != len("img/logo..png")+6 {
+		t.Errorf("expected a 6 character hash, got %q", result)
+	}
+	if gtml.FingerprintPath("img/logo.png", []byte("changed")) == result {
+		t.Error("expected fingerprint to change with content")
+	}
+}
+
+func TestRewriteAssetReferences(t *testing.T) {
+	manifest := map[string]string{
+		"static/app.js":     "static/app.111111.js",
+		"static/app.js.map": "static/app.js.222222.map",
+	}
+
+	input := `<script src="/static/app.js"></script><a href='/static/app.js.map'></a><img src="/static/app.jsx">`
+	expected := `<script src="/static/app.111111.js"></script><a href='/static/app.js.222222.map'></a><img src="/static/app.jsx">`
+
+	if result := gtml.RewriteAssetReferences(input, manifest); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestRewriteAssetReferences_OnlyReferences(t *testing.T) {
+	manifest := map[string]string{"static/logo.png": "static/logo.111111.png"}
+
+	input := `<img srcset="/static/logo.png 1x, /static/logo.png 2x" src=/static/logo.png><p style="background: url( '/static/logo.png' )">Served from /static/logo.png</p><code>&lt;img src="/static/logo.png"&gt;</code>`
+	expected := `<img srcset="/static/logo.111111.png 1x, /static/logo.111111.png 2x" src=/static/logo.111111.png><p style="background: url( '/static/logo.111111.png' )">Served from /static/logo.png</p><code>&lt;img src="/static/logo.png"&gt;</code>`
+
+	if result := gtml.RewriteAssetReferences(input, manifest); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestCompileProject_FingerprintAssets(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Layout.html": `<html><head><link rel="stylesheet" href="/static/styles.css"></head><body><img src="/static/logo.png"><slot name='content' /></body></html>`,
+		"routes/index.html":      `<Layout><slot name='content' tag='main'><p>Hi</p></slot></Layout>`,
+		"static/logo.png":        "not really a png",
+		"static/site.css":        `body { background: url(/static/logo.png); }`,
+	})
+
+	opts := testCompileOptions()
+	opts.FingerprintAssets = true
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, "dist", "asset-manifest.json"))
+	if err != nil {
+		t.Fatalf("expected asset-manifest.json to be written: %v", err)
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+
+	for _, key := range []string{"static/logo.png", "static/site.css", "static/styles.css"} {
+		hashed, ok := manifest[key]
+		if !ok || hashed == key {
+			t.Errorf("expected %s to be fingerprinted, got %q", key, hashed)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, "dist", hashed)); err != nil {
+			t.Errorf("expected fingerprinted file %s to exist", hashed)
+		}
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "/"+manifest["static/styles.css"]) || !strings.Contains(string(html), "/"+manifest["static/logo.png"]) {
+		t.Errorf("expected compiled HTML to reference fingerprinted assets, got: %s", html)
+	}
+
+	css, err := os.ReadFile(filepath.Join(dir, "dist", manifest["static/site.css"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(css), "/"+manifest["static/logo.png"]) {
+		t.Errorf("expected static CSS to reference fingerprinted assets, got: %s", css)
+	}
+}
+
+func TestCompileProject_FingerprintRelativeReferences(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Box.html":   `<div><p>box</p></div>`,
+		"routes/index.html":     `<html><body><Box /><script>const icon = 'static/img/icon.png';</script></body></html>`,
+		"static/img/icon.png":   "icon",
+		"static/img/bg.png":     "bg",
+		"static/css/site.css":   `a { background: url(../img/icon.png); } b { background: url("./local.png?v=1"); } i { background: url(data:image/png;base64,AA==); }`,
+		"static/css/local.png":  "local",
+		"static/css/nested.css": `p { background: url('../img/bg.png#frag'); }`,
+	})
+
+	opts := testCompileOptions()
+	opts.FingerprintAssets = true
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, "dist", "asset-manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+
+	css, err := os.ReadFile(filepath.Join(dir, "dist", manifest["static/css/site.css"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	icon := filepath.Base(manifest["static/img/icon.png"])
+	local := filepath.Base(manifest["static/css/local.png"])
+	for _, expected := range []string{
+		"url(../img/" + icon + ")",
+		`url("` + local + `?v=1")`,
+		"url(data:image/png;base64,AA==)",
+	} {
+		if !strings.Contains(string(css), expected) {
+			t.Errorf("expected %s in the fingerprinted stylesheet, got: %s", expected, css)
+		}
+	}
+
+	nested, err := os.ReadFile(filepath.Join(dir, "dist", manifest["static/css/nested.css"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(nested), "url('../img/"+filepath.Base(manifest["static/img/bg.png"])+"#frag')") {
+		t.Errorf("expected the quoted url to be rewritten, got: %s", nested)
+	}
+
+	// References the compiler can't rewrite still resolve to the original names
+	for _, name := range []string{"static/img/icon.png", "static/css/site.css", "static/styles.css"} {
+		if _, err := os.Stat(filepath.Join(dir, "dist", name)); err != nil {
+			t.Errorf("expected the original dist/%s to be kept", name)
+		}
+	}
+}
+
+func TestCompileProject_StableBetweenBuilds(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Counter.html": `<div props='start int'><p>{$count}</p><button id='inc'>+</button><button onclick={() => { $count = $count + 1 }}>+</button><script type='gtml'>
+  $count = $start
+  #inc.onclick(() => { $count = $count + 1 })
+</script></div>`,
+		"routes/index.html": `<html><body><Counter start={1} /><ul fetch='GET /api/users' as='users'><li for='user in users'>{user.name ? user.name : "?"}</li></ul><form action='POST /api/users'><button>Add</button></form></body></html>`,
+	})
+
+	opts := testCompileOptions()
+	opts.FingerprintAssets = true
+	opts.SharedRuntime = true
+
+	read := func() map[string]string {
+		files := make(map[string]string)
+		filepath.Walk(filepath.Join(dir, "dist"), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				data, _ := os.ReadFile(path)
+				files[path] = string(data)
+			}
+			return nil
+		})
+		return files
+	}
+
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	first := read()
+	if err := os.RemoveAll(filepath.Join(dir, "dist")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	second := read()
+
+	if len(first) != len(second) {
+		t.Fatalf("expected the same files from both builds, got %d and %d", len(first), len(second))
+	}
+	for path, content := range first {
+		if second[path] != content {
+			t.Errorf("expected %s to be identical between builds", path)
+		}
+	}
+}
+
+func TestCompileProject_WithoutFingerprint(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Box.html": `<div><p>box</p></div>`,
+		"routes/index.html":   `<Box />`,
+		"static/logo.png":     "logo",
+	})
+
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+
+	for _, name := range []string{"static/logo.png", "static/styles.css", "index.html"} {
+		if _, err := os.Stat(filepath.Join(dir, "dist", name)); err != nil {
+			t.Errorf("expected dist/%s to exist", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dist", "asset-manifest.json")); err == nil {
+		t.Error("expected no asset manifest without fingerprinting")
+	}
+}
+
+func TestCompileProject_StaticFileModes(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Box.html": `<div><p>box</p></div>`,
+		"routes/index.html":   `<Box />`,
+		"static/run.sh":       "#!/bin/sh",
+		"static/secret.txt":   "secret",
+	})
+	if err := os.Chmod(filepath.Join(dir, "static", "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "static", "secret.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testCompileOptions()
+	opts.FingerprintAssets = true
+	for build := 0; build < 2; build++ {
+		if err := gtml.CompileProject(dir, opts); err != nil {
+			t.Fatalf("CompileProject failed: %v", err)
+		}
+	}
+
+	for name, mode := range map[string]os.FileMode{"run.sh": 0755, "secret.txt": 0600, "styles.css": 0644} {
+		info, err := os.Stat(filepath.Join(dir, "dist", "static", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected dist/static/%s to have mode %v, got %v", name, mode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestCompileProject_SharedRuntime(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Users.html": `<div fetch='GET /api/users' as='users'><li for='user in users'>{user.name}</li></div>`,
+		"routes/index.html":     `<main><Users /><Users /></main>`,
+		"routes/blog/post.html": `<main><Users /></main>`,
+		"routes/about.html":     `<main><p>No scripts here</p></main>`,
+	})
+
+	opts := testCompileOptions()
+	opts.SharedRuntime = true
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+
+	runtime, err := os.ReadFile(filepath.Join(dir, "dist", "static", "gtml-runtime.js"))
+	if err != nil {
+		t.Fatalf("expected gtml-runtime.js to be written: %v", err)
+	}
+	for _, helper := range []string{"class GtmlSignal", "function processForLoops", "function replaceExpressions"} {
+		if !strings.Contains(string(runtime), helper) {
+			t.Errorf("expected runtime to contain %q", helper)
+		}
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), "<script>") {
+		t.Errorf("expected no inline scripts, got: %s", index)
+	}
+	if !strings.Contains(string(index), `<script src="/static/gtml-runtime.js"></script>`) || !strings.Contains(string(index), `<script src="/static/gtml/index.js"></script>`) {
+		t.Errorf("expected runtime and route chunk references, got: %s", index)
+	}
+
+	chunk, err := os.ReadFile(filepath.Join(dir, "dist", "static", "gtml", "index.js"))
+	if err != nil {
+		t.Fatalf("expected route chunk to be written: %v", err)
+	}
+	if strings.Count(string(chunk), "fetch('/api/users'") != 2 {
+		t.Errorf("expected route chunk to contain both fetch scripts, got: %s", chunk)
+	}
+	if strings.Contains(string(chunk), "function replaceExpressions") {
+		t.Error("expected helpers to be shipped only in the runtime")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "dist", "static", "gtml", "blog", "post.js")); err != nil {
+		t.Errorf("expected nested route chunk to be written: %v", err)
+	}
+
+	about, err := os.ReadFile(filepath.Join(dir, "dist", "about.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(about), "gtml-runtime.js") {
+		t.Errorf("expected routes without scripts to skip the runtime, got: %s", about)
+	}
+}
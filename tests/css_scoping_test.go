@@ -1,6 +1,9 @@
 package main_test
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -48,6 +51,122 @@ func TestProcessComponentStyles_NoStyle(t *testing.T) {
 	}
 }
 
+func TestProcessComponentStyles_MultipleBlocks(t *testing.T) {
+	input := `<style>
+p { color: red; }
+</style>
+<div><p>Hello</p></div>
+<style lang="css">
+span { color: blue; }
+</style>`
+
+	html, css, err := processComponentStyles(input, "data-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Contains(html, "<style") {
+		t.Errorf("HTML should not contain any style blocks, got: %s", html)
+	}
+
+	if !strings.Contains(css, "[data-test] p") || !strings.Contains(css, "[data-test] span") {
+		t.Errorf("CSS should contain rules from both blocks, got: %s", css)
+	}
+}
+
+func TestProcessComponentStyles_Media(t *testing.T) {
+	input := `<style media="(max-width: 600px)">
+p { color: red; }
+</style>
+<div><p>Hello</p></div>`
+
+	_, css, err := processComponentStyles(input, "data-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(css, "@media (max-width: 600px) {") {
+		t.Errorf("CSS should be wrapped in the media query, got: %s", css)
+	}
+}
+
+func TestProcessComponentStyles_UnsupportedLang(t *testing.T) {
+	input := `<style lang="scss">p { color: red; }</style><div></div>`
+
+	if _, _, err := processComponentStyles(input, "data-test"); err == nil {
+		t.Error("expected error for unsupported style lang, got nil")
+	}
+}
+
+func TestResolveStylesheetLinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Button.css"), []byte("button { color: red; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `<link rel="stylesheet" href="./Button.css">
+<link rel="stylesheet" href="/static/styles.css">
+<button>Click</button>`
+
+	resolved, err := gtml.ResolveStylesheetLinks(input, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(resolved, "button { color: red; }") {
+		t.Errorf("expected linked stylesheet to be inlined, got: %s", resolved)
+	}
+	if !strings.Contains(resolved, `href="/static/styles.css"`) {
+		t.Errorf("expected absolute stylesheet link to be preserved, got: %s", resolved)
+	}
+
+	html, css, err := processComponentStyles(resolved, "data-button")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(css, "[data-button] button") {
+		t.Errorf("expected linked stylesheet to be scoped, got: %s", css)
+	}
+	if strings.Contains(html, "Button.css") {
+		t.Errorf("expected link tag to be removed from template, got: %s", html)
+	}
+}
+
+func TestResolveStylesheetLinks_UnquotedAndMedia(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Button.css"), []byte("button { color: red; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `<link rel=stylesheet href=./Button.css media="(width >= 600px)"><link REL='Stylesheet' href='./Button.css' media="print' onload='x"><button>Click</button>`
+	resolved, err := gtml.ResolveStylesheetLinks(input, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(resolved, "<link") {
+		t.Errorf("expected both links to be inlined, got: %s", resolved)
+	}
+	if !strings.Contains(resolved, "<style media='print&#39; onload=&#39;x'>") {
+		t.Errorf("expected the media attribute to be escaped, got: %s", resolved)
+	}
+
+	_, css, err := processComponentStyles(resolved, "data-button")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(css, "@media (width >= 600px) {") {
+		t.Errorf("expected the media query to be kept as written, got: %s", css)
+	}
+}
+
+func TestResolveStylesheetLinks_MissingFile(t *testing.T) {
+	input := `<link rel="stylesheet" href="./Missing.css"><div></div>`
+
+	if _, err := gtml.ResolveStylesheetLinks(input, t.TempDir()); err == nil {
+		t.Error("expected error for missing stylesheet, got nil")
+	}
+}
+
 func TestInjectScopeID(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -81,3 +200,255 @@ func processComponentStyles(raw string, scopeID string) (string, string, error)
 func injectScopeID(html string, scopeID string) string {
 	return gtml.InjectScopeID(html, scopeID)
 }
+
+func TestProcessComponentStyles_PropReferences(t *testing.T) {
+	input := `<style>
+.badge { background: {color}; }
+</style>
+<span class='badge' props='color string'>Hi</span>`
+
+	_, css, err := processComponentStyles(input, "data-badge")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(css, "background: var(--gtml-color);") {
+		t.Errorf("expected prop reference to compile to a custom property, got: %s", css)
+	}
+
+	props := gtml.StyleProps(css)
+	if len(props) != 1 || props[0] != "color" {
+		t.Errorf("expected StyleProps to return [color], got: %v", props)
+	}
+}
+
+func TestProcessComponentStyles_PropReferencesSkipStringsAndComments(t *testing.T) {
+	input := `<style>
+/* uses {size} for the badge */
+.badge { content: "{label} }"; quotes: '{open}' '{close}'; width: {size}; }
+.badge:hover { color: red; }
+</style>
+<span class='badge' props='size string'>Hi</span>`
+
+	_, css, err := processComponentStyles(input, "data-badge")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		`/* uses {size} for the badge */`,
+		`content: "{label} }";`,
+		`quotes: '{open}' '{close}';`,
+		`width: var(--gtml-size);`,
+		`.badge:hover[data-badge] { color: red; }`,
+	} {
+		if !strings.Contains(css, expected) {
+			t.Errorf("expected %q in the scoped css, got: %s", expected, css)
+		}
+	}
+
+	props := gtml.StyleProps(css + `.x { content: "var(--gtml-label)"; }`)
+	if len(props) != 1 || props[0] != "size" {
+		t.Errorf("expected StyleProps to return [size], got: %v", props)
+	}
+}
+
+func TestStyleProps_PerInstanceVariables(t *testing.T) {
+	template := gtml.InjectStyleProps(`<span class='badge' data-badge="">{text}</span>`, []string{"color"})
+	state := createTestState(map[string]string{
+		"Badge": `<span props='text string, color string'>{text}</span>`,
+	})
+	state.Components["Badge"].Template = template
+
+	input := `<div><Badge text='One' color='red' /><Badge text='Two' color='blue' /></div>`
+
+	result, err := gtml.CompileHTML(input, state, map[string]gtml.Value{}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, `style="--gtml-color: red"`) || !strings.Contains(result, `style="--gtml-color: blue"`) {
+		t.Errorf("expected each instance to set its own custom property, got: %s", result)
+	}
+}
+
+func TestApplyStyleDirectives(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`<div style:--accent={accent}></div>`,
+			`<div style="--accent: {accent}"></div>`,
+		},
+		{
+			`<div style='color: red;' style:--accent='blue'></div>`,
+			`<div style='color: red; --accent: blue'></div>`,
+		},
+		{
+			`<img style:--size={size} />`,
+			`<img style="--size: {size}" />`,
+		},
+		{
+			`<div class='plain'></div>`,
+			`<div class='plain'></div>`,
+		},
+	}
+
+	for _, tt := range tests {
+		result := gtml.ApplyStyleDirectives(tt.input)
+		if result != tt.expected {
+			t.Errorf("ApplyStyleDirectives(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestStyleDirective_EvaluatesProps(t *testing.T) {
+	state := createTestState(map[string]string{
+		"Card": `<div props='accent string' style:--accent={accent}><p>Card</p></div>`,
+	})
+
+	result, err := gtml.CompileHTML(`<Card accent='#ff0000' />`, state, map[string]gtml.Value{}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, `style="--accent: #ff0000"`) {
+		t.Errorf("expected style directive to compile to an inline custom property, got: %s", result)
+	}
+}
+
+func TestStyleDirective_EscapesValues(t *testing.T) {
+	state := createTestState(map[string]string{
+		"Card": `<div props='accent string' style:--accent={accent}><p>Card</p></div>`,
+	})
+
+	tests := []struct {
+		accent   string
+		expected string
+	}{
+		{`red" onclick="alert(1)`, `style="--accent: red&quot; onclick=&quot;alert(1)"`},
+		{`red' onclick='alert(1)`, `style="--accent: red&#39; onclick=&#39;alert(1)"`},
+		{`red; } body { color: blue`, `style="--accent: red\; \} body \{ color: blue"`},
+	}
+
+	for _, tt := range tests {
+		quote := "'"
+		if strings.Contains(tt.accent, "'") {
+			quote = `"`
+		}
+		result, err := gtml.CompileHTML(`<Card accent=`+quote+tt.accent+quote+` />`, state, map[string]gtml.Value{}, true)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.accent, err)
+		}
+		if !strings.Contains(result, tt.expected) {
+			t.Errorf("expected %s, got: %s", tt.expected, result)
+		}
+		if strings.Contains(result, `onclick="`) || strings.Contains(result, "onclick='") {
+			t.Errorf("expected the value to stay inside the style attribute, got: %s", result)
+		}
+	}
+}
+
+func TestScopeID(t *testing.T) {
+	nameID, err := gtml.ScopeID("Id", "<div></div>", gtml.ScopeIDName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nameID != "data-id" {
+		t.Errorf("expected name strategy to produce data-id, got %q", nameID)
+	}
+
+	hashID, err := gtml.ScopeID("Id", "<div></div>", gtml.ScopeIDHash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hashID, "data-g-") || len(hashID) != len("data-g-")+6 {
+		t.Errorf("expected hash strategy to produce data-g-xxxxxx, got %q", hashID)
+	}
+	if strings.Contains(hashID, "id-") {
+		t.Errorf("hash strategy should not leak the component name, got %q", hashID)
+	}
+
+	again, _ := gtml.ScopeID("Id", "<div></div>", gtml.ScopeIDHash)
+	if again != hashID {
+		t.Errorf("expected hashed scope IDs to be stable, got %q and %q", hashID, again)
+	}
+
+	other, _ := gtml.ScopeID("Other", "<div></div>", gtml.ScopeIDHash)
+	if other == hashID {
+		t.Errorf("expected different components with equal content to get different scope IDs")
+	}
+
+	debugID, err := gtml.ScopeID("Id", "<div></div>", gtml.ScopeIDDebug)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if debugID != "data-g-id-"+strings.TrimPrefix(hashID, "data-g-") {
+		t.Errorf("expected debug strategy to keep the readable name, got %q", debugID)
+	}
+
+	if _, err := gtml.ScopeID("Id", "<div></div>", "bogus"); err == nil {
+		t.Error("expected error for unknown scope ID strategy, got nil")
+	}
+}
+
+func TestCompileProject_ScopeIDCollision(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/MyButton.html": `<button><style>button { color: red; }</style>One</button>`,
+		"components/Mybutton.html": `<button><style>button { color: blue; }</style>Two</button>`,
+		"routes/index.html":        `<html><head></head><body><MyButton /><Mybutton /></body></html>`,
+	})
+	opts := testCompileOptions()
+	opts.ScopeIDs = gtml.ScopeIDName
+
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `<button data-mybutton="">One</button><button data-mybutton-2="">Two</button>`) {
+		t.Errorf("expected the second component to get a numbered scope ID, got: %s", out)
+	}
+}
+
+func TestCompileProject_DefaultScopeIDs(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Id.html": `<span><style>span { color: red; }</style>1</span>`,
+		"routes/index.html":  `<html><head></head><body><Id /></body></html>`,
+	})
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "data-id") || !regexp.MustCompile(`<span data-g-id-[0-9a-f]{6}="">1</span>`).Match(out) {
+		t.Errorf("expected a hashed scope ID by default, got: %s", out)
+	}
+}
+
+func TestCompileProject_HashScopeIDsHideNames(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/SecretPanel.html": `<div><style>p { color: red; }</style><p>Hi</p></div>`,
+		"routes/index.html":           `<html><head></head><body><SecretPanel /></body></html>`,
+	})
+	opts := testCompileOptions()
+	opts.ScopeIDs = gtml.ScopeIDHash
+
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	for _, file := range []string{"dist/static/styles.css", "dist/index.html"} {
+		out, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(out), "SecretPanel") || strings.Contains(strings.ToLower(string(out)), "secretpanel") {
+			t.Errorf("expected %s not to mention the component name, got: %s", file, out)
+		}
+	}
+}
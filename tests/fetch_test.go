@@ -1,6 +1,13 @@
 package main_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -215,15 +222,20 @@ func TestParseForAttribute(t *testing.T) {
 	tests := []struct {
 		input        string
 		itemName     string
+		indexName    string
 		sourcePath   string
 		shouldError  bool
 	}{
-		{"user in users", "user", "users", false},
-		{"item in items", "item", "items", false},
-		{"color in user.colors", "color", "user.colors", false},
-		{"child in parent.children", "child", "parent.children", false},
-		{"invalid format", "", "", true},
-		{"missing_in_keyword", "", "", true},
+		{"user in users", "user", "", "users", false},
+		{"item in items", "item", "", "items", false},
+		{"color in user.colors", "color", "", "user.colors", false},
+		{"child in parent.children", "child", "", "parent.children", false},
+		{"user, i in users", "user", "i", "users", false},
+		{"color,j in user.colors", "color", "j", "user.colors", false},
+		{"invalid format", "", "", "", true},
+		{"missing_in_keyword", "", "", "", true},
+		{"user, in users", "", "", "", true},
+		{"user, i, j in users", "", "", "", true},
 	}
 
 	for _, tt := range tests {
@@ -245,12 +257,61 @@ func TestParseForAttribute(t *testing.T) {
 			t.Errorf("ParseForAttribute(%q) ItemName = %q, expected %q", tt.input, forLoop.ItemName, tt.itemName)
 		}
 
+		if forLoop.IndexName != tt.indexName {
+			t.Errorf("ParseForAttribute(%q) IndexName = %q, expected %q", tt.input, forLoop.IndexName, tt.indexName)
+		}
+
 		if forLoop.SourcePath != tt.sourcePath {
 			t.Errorf("ParseForAttribute(%q) SourcePath = %q, expected %q", tt.input, forLoop.SourcePath, tt.sourcePath)
 		}
 	}
 }
 
+// TestFetchForLoopIndexAndKey tests loop indexes, loop metadata and keyed items
+func TestFetchForLoopIndexAndKey(t *testing.T) {
+	html := `<div fetch='GET /api/teams' as='teams'>
+  <section for='team, t in teams' key='{team.id}'>
+    <h2>{t}. {team.name}</h2>
+    <p for='member in team.members'>{loop.parent.index}.{loop.index} {member}</p>
+  </section>
+</div>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	if !strings.Contains(result, `data-gtml-item="team" data-gtml-index="t" data-gtml-source="teams"`) {
+		t.Errorf("Expected the index name on the loop template, got: %s", result)
+	}
+	if !strings.Contains(result, `data-gtml-key="gtml-for-`) || !strings.Contains(result, `:{team.id}"`) {
+		t.Errorf("Expected a loop-scoped key, got: %s", result)
+	}
+	if strings.Contains(result, "key='{team.id}'") {
+		t.Error("Expected the key attribute to be replaced by data-gtml-key")
+	}
+	if !strings.Contains(result, "gtmlReconcile(container, content);") {
+		t.Error("Expected keyed lists to be reconciled with the previous render")
+	}
+	if !strings.Contains(result, "parent: scope.loop") {
+		t.Error("Expected nested loops to see their parent loop")
+	}
+}
+
+// TestFetchUnkeyedLoopReplacesContent tests that lists without keys are re-rendered in full
+func TestFetchUnkeyedLoopReplacesContent(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<ul fetch='GET /api/users' as='users'><li for='user in users'>{user.name}</li></ul>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "container.replaceChildren(content);") {
+		t.Errorf("Expected unkeyed lists to replace the container content, got: %s", result)
+	}
+	if strings.Contains(result, `data-gtml-index="`) {
+		t.Error("Expected no index marker without an index name")
+	}
+}
+
 // TestMultipleFetchElements tests multiple fetch elements on the same page
 func TestMultipleFetchElements(t *testing.T) {
 	html := `<div>
@@ -440,3 +501,967 @@ func TestFetchResponseValidation(t *testing.T) {
 		t.Error("Expected response.ok validation")
 	}
 }
+
+// TestFetchSharedRuntime tests that fetch scripts rely on the shared runtime helpers
+func TestFetchSharedRuntime(t *testing.T) {
+	state := createTestState(map[string]string{})
+	state.SharedRuntime = true
+
+	html := `<div fetch='GET /api/users' as='users'><li for='user in users'>{user.name}</li></div>`
+	result, err := gtml.CompileHTML(html, state, map[string]gtml.Value{}, true)
+	if err != nil {
+		t.Fatalf("CompileHTML failed: %v", err)
+	}
+
+	// The page should not contain any scripts
+	if strings.Contains(result, "<script>") {
+		t.Errorf("Expected fetch script to be moved out of the page, got: %s", result)
+	}
+
+	script := state.InteractivityJS.String()
+	if !strings.Contains(script, "processForLoops(content, initialScope)") {
+		t.Error("Expected collected fetch script to call the shared processForLoops helper")
+	}
+	if strings.Contains(script, "function replaceExpressions") || strings.Contains(script, "function getValueByPath") {
+		t.Error("Expected fetch helpers to be left to the shared runtime")
+	}
+}
+
+// TestFetchRequestOptions tests headers, credentials and mode on fetch elements
+func TestFetchRequestOptions(t *testing.T) {
+	html := `<div fetch='GET /api/me' as='me' fetch-headers='Authorization: Bearer abc; X-Client: gtml' fetch-credentials='include' fetch-mode='cors'></div>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	expected := `fetch('/api/me', { method: 'GET', headers: { "Authorization": "Bearer abc", "X-Client": "gtml" }, credentials: 'include', mode: 'cors', signal: controller.signal })`
+	if !strings.Contains(result, expected) {
+		t.Errorf("Expected fetch options %s, got: %s", expected, result)
+	}
+	if strings.Contains(result, "fetch-headers") || strings.Contains(result, "fetch-credentials") || strings.Contains(result, "fetch-mode") {
+		t.Error("Expected fetch option attributes to be removed from the element")
+	}
+	if strings.Contains(result, "gtmlScope") {
+		t.Error("Expected fetches without signals to not need a signal scope")
+	}
+}
+
+// TestFetchJSONBody tests that fetch-body compiles to a JSON request body
+func TestFetchJSONBody(t *testing.T) {
+	html := `<div fetch='POST /api/todos' as='todo' fetch-body='title: $title, userId: 42, done: false, note: "a, b", tag: draft'></div>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	expected := `headers: { "Content-Type": "application/json" }, body: JSON.stringify({ "title": _s.get('title'), "userId": 42, "done": false, "note": "a, b", "tag": "draft" })`
+	if !strings.Contains(result, expected) {
+		t.Errorf("Expected JSON body %s, got: %s", expected, result)
+	}
+	if !strings.Contains(result, "const _s = gtmlScope(instance ? instance.getAttribute('data-gtml-instance') : '');") {
+		t.Error("Expected signal reads to resolve against the closest component instance")
+	}
+}
+
+// TestFetchBodyFromSignal tests sending a whole signal as the body
+func TestFetchBodyFromSignal(t *testing.T) {
+	html := `<div fetch='PUT /api/profile' as='profile' fetch-body='$form' fetch-headers='Content-Type: application/json; charset=utf-8; X-Token: $token'></div>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	if !strings.Contains(result, "body: JSON.stringify(_s.get('form'))") {
+		t.Errorf("Expected signal body, got: %s", result)
+	}
+	if !strings.Contains(result, `"X-Token": _s.get('token')`) {
+		t.Errorf("Expected header to read a signal, got: %s", result)
+	}
+	if !strings.Contains(result, `"Content-Type": "application/json; charset=utf-8"`) {
+		t.Errorf("Expected header parameters to stay with their header, got: %s", result)
+	}
+	if strings.Count(result, "Content-Type") != 1 {
+		t.Errorf("Expected an explicit Content-Type to replace the default, got: %s", result)
+	}
+}
+
+// TestFetchInvalidRequestOptions tests validation of fetch request options
+func TestFetchInvalidRequestOptions(t *testing.T) {
+	tests := []string{
+		`<div fetch='GET /api/users' as='users' fetch-body='name: Ada'></div>`,
+		`<div fetch='POST /api/users' as='users' fetch-body='name'></div>`,
+		`<div fetch='GET /api/users' as='users' fetch-headers='Authorization'></div>`,
+		`<div fetch='GET /api/users' as='users' fetch-credentials='always'></div>`,
+		`<div fetch='GET /api/users' as='users' fetch-mode='navigate'></div>`,
+	}
+
+	for _, html := range tests {
+		if _, err := gtml.ProcessFetchElements(html); err == nil {
+			t.Errorf("Expected error for %s", html)
+		}
+	}
+}
+
+// TestCompileProject_FetchBodyFromPropsAndSignals tests request options inside a component
+func TestCompileProject_FetchBodyFromPropsAndSignals(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/TodoForm.html": `<div props='userId int, token string'>
+  <script type='gtml'>
+    $title = 'Write docs'
+  </script>
+  <div fetch='POST /api/todos' as='todo' fetch-headers='Authorization: Bearer {token}' fetch-body='title: $title, userId: {userId}'>
+    <p>{todo.title}</p>
+  </div>
+</div>`,
+		"routes/index.html": `<TodoForm userId={7} token='abc' />`,
+	})
+
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(output)
+
+	expected := `headers: { "Content-Type": "application/json", "Authorization": "Bearer abc" }, body: JSON.stringify({ "title": _s.get('title'), "userId": 7 })`
+	if !strings.Contains(result, expected) {
+		t.Errorf("Expected prop values and signal reads in the request, got: %s", result)
+	}
+
+	// The fetch runs after the signal library and the component's script
+	library := strings.Index(result, "function gtmlScope")
+	init := strings.Index(result, "_s.set('title'")
+	request := strings.Index(result, "fetch('/api/todos'")
+	if library == -1 || init == -1 || !(library < init && init < request) {
+		t.Errorf("Expected the fetch script after the signal runtime and component script, got: %s", result)
+	}
+}
+
+// TestFetchReactiveURL tests that signals in a fetch url refetch the element
+func TestFetchReactiveURL(t *testing.T) {
+	html := `<ul fetch='GET /api/users?page={$page}&q={$query}' as='users'><li for='user in users'>{user.name}</li></ul>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	expected := "fetch(`/api/users?page=${encodeURIComponent(_s.get('page') ?? '')}&q=${encodeURIComponent(_s.get('query') ?? '')}`, { method: 'GET', signal: controller.signal })"
+	if !strings.Contains(result, expected) {
+		t.Errorf("Expected url to read signals, got: %s", result)
+	}
+	if !strings.Contains(result, "if (controller) controller.abort();") {
+		t.Error("Expected in-flight requests to be aborted")
+	}
+	if !strings.Contains(result, "if (error.name === 'AbortError') return;") {
+		t.Error("Expected aborted requests to not show the fallback")
+	}
+	if !strings.Contains(result, "gtmlEffect(() => {\n    _s.get('page');\n    _s.get('query');\n    gtmlUntracked(load);\n  });") {
+		t.Errorf("Expected an effect that refetches when the url signals change, got: %s", result)
+	}
+	if strings.Contains(result, "  load();\n") {
+		t.Error("Expected the effect to make the first request")
+	}
+}
+
+// TestFetchStaticURLLoadsOnce tests that fetch elements without signals request once
+func TestFetchStaticURLLoadsOnce(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/users' as='users'></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "  load();\n") || strings.Contains(result, "gtmlEffect") {
+		t.Errorf("Expected a single request without an effect, got: %s", result)
+	}
+}
+
+// TestCompileProject_ReactiveFetchURL tests signal reads in a component's fetch url
+func TestCompileProject_ReactiveFetchURL(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/UserPager.html": `<div props='base string'>
+  <script type='gtml'>
+    $page = 1
+  </script>
+  <ul fetch='GET {base}/users?page={$page}' as='users'>
+    <li for='user in users'>{user.name}</li>
+  </ul>
+</div>`,
+		"routes/index.html": `<UserPager base='/api' />`,
+	})
+
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(output)
+
+	if !strings.Contains(result, "fetch(`/api/users?page=${encodeURIComponent(_s.get('page') ?? '')}`") {
+		t.Errorf("Expected the prop to be compiled in and the signal read at runtime, got: %s", result)
+	}
+	if strings.Contains(result, "data-gtml-bind='") {
+		t.Error("Expected the fetch url to not become an attribute binding")
+	}
+	if strings.Index(result, "_s.set('page', 1)") > strings.Index(result, "fetch(`/api/users") {
+		t.Error("Expected the fetch script to run after the component script")
+	}
+}
+
+// TestFetchInterval tests polling with fetch-interval
+func TestFetchInterval(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/status' as='status' fetch-interval='30s'></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "setInterval(() => { if (!document.hidden) load(true); }, 30000);") {
+		t.Errorf("Expected a 30 second poll, got: %s", result)
+	}
+	if strings.Contains(result, "fetch-interval") {
+		t.Error("Expected fetch-interval to be removed from the element")
+	}
+}
+
+// TestFetchRefetchRegistration tests that named fetch elements can be refetched
+func TestFetchRefetchRegistration(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/users' as='users'></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "_gtmlFetches().push({ name: 'users', container, load: () => load(true) });") {
+		t.Errorf("Expected the element to register for refetch, got: %s", result)
+	}
+	if !strings.Contains(result, "function refetch(name, root)") {
+		t.Error("Expected the fetch helpers to define refetch")
+	}
+}
+
+// TestFetchCache tests stale-while-revalidate caching with fetch-cache
+func TestFetchCache(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/users' as='users' fetch-cache='60s'></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "gtmlCachedFetch('/api/users', { method: 'GET' }, revalidate ? 0 : 60000, users => {") {
+		t.Errorf("Expected a cached fetch fresh for 60 seconds, got: %s", result)
+	}
+	if strings.Contains(result, "new AbortController()") {
+		t.Error("Expected cached requests to be shared instead of aborted")
+	}
+
+	result, err = gtml.ProcessFetchElements(`<div fetch='GET /api/users' as='users' fetch-cache></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "gtmlCachedFetch('/api/users', { method: 'GET' }, 0, users => {") {
+		t.Errorf("Expected a bare fetch-cache to always revalidate, got: %s", result)
+	}
+	if strings.Contains(result, "fetch-cache") {
+		t.Error("Expected fetch-cache to be removed from the element")
+	}
+}
+
+// TestFetchCacheRuntime tests the cache key and stale data on failed revalidation
+func TestFetchCacheRuntime(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/users' as='users' fetch-cache></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "const key = url + ' ' + JSON.stringify(options);") {
+		t.Errorf("Expected cache entries to be keyed by the url and the request options, got: %s", result)
+	}
+	if !strings.Contains(result, "if (!stale) throw error;") {
+		t.Errorf("Expected a failed revalidation to keep the stale data, got: %s", result)
+	}
+}
+
+// TestFetchInvalidPollingAndCache tests validation of fetch-interval and fetch-cache
+func TestFetchInvalidPollingAndCache(t *testing.T) {
+	tests := []string{
+		`<div fetch='GET /api/users' as='users' fetch-interval='often'></div>`,
+		`<div fetch='GET /api/users' as='users' fetch-interval='0s'></div>`,
+		`<div fetch='GET /api/users' as='users' fetch-cache='soon'></div>`,
+		`<div fetch='POST /api/users' as='users' fetch-cache></div>`,
+	}
+
+	for _, html := range tests {
+		if _, err := gtml.ProcessFetchElements(html); err == nil {
+			t.Errorf("Expected error for %s", html)
+		}
+	}
+}
+
+// TestFetchEmptyState tests the empty child of a fetch element
+func TestFetchEmptyState(t *testing.T) {
+	html := `<ul fetch='GET /api/users' as='users'>
+  <p empty>No users yet</p>
+  <li for='user in users'>{user.name}</li>
+</ul>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "const emptyContent = `No users yet`;") {
+		t.Errorf("Expected the empty child to be stored, got: %s", result)
+	}
+	if !strings.Contains(result, "if (users == null || (Array.isArray(users) && users.length === 0)) {") {
+		t.Errorf("Expected an empty check on the data, got: %s", result)
+	}
+	if strings.Contains(result, "<p empty>") {
+		t.Error("Expected the empty child to be removed from the template")
+	}
+}
+
+// TestFetchStatusFallbacks tests fallbacks selected by response status
+func TestFetchStatusFallbacks(t *testing.T) {
+	html := `<div fetch='GET /api/user' as='user'>
+  <div fallback='404'><p>No such user</p></div>
+  <div fallback='5xx'><p>Server error {status}</p></div>
+  <div fallback><p>{error.message}</p></div>
+  <p>{user.name}</p>
+</div>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"{ status: '404', template: `<p>No such user</p>` },",
+		"{ status: '5xx', template: `<p>Server error {status}</p>` },",
+		"{ status: '', template: `<p>{error.message}</p>` },",
+		"const match = gtmlFallbackFor(fallbacks, status);",
+		"replaceExpressions(match.template, { error: { message: error.message, status }, status })",
+		"throw new Error('Request failed with status ' + response.status, { cause: response })",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %s, got: %s", expected, result)
+		}
+	}
+	if strings.Contains(result, "fallback='") {
+		t.Error("Expected fallback children to be removed from the template")
+	}
+}
+
+// TestFetchInvalidFallbackStatus tests validation of fallback statuses
+func TestFetchInvalidFallbackStatus(t *testing.T) {
+	for _, status := range []string{"40", "600", "4x", "error"} {
+		html := `<div fetch='GET /api/user' as='user'><div fallback='` + status + `'>oops</div></div>`
+		if _, err := gtml.ProcessFetchElements(html); err == nil {
+			t.Errorf("Expected error for fallback='%s'", status)
+		}
+	}
+}
+
+// TestFetchEscapesInterpolations tests that fetched values are HTML-escaped
+func TestFetchEscapesInterpolations(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<ul fetch='GET /api/users' as='users'><li for='user in users'><a href='{user.url}'>{user.name}</a><div>{@html user.bio}</div></li></ul>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	if !strings.Contains(result, "return raw ? String(value) : escapeHTML(value);") {
+		t.Error("Expected text values to be escaped unless marked raw")
+	}
+	if !strings.Contains(result, "function escapeHTML(value)") {
+		t.Error("Expected the fetch helpers to define escapeHTML")
+	}
+	if !strings.Contains(result, "text = 'about:blank';") {
+		t.Error("Expected script URLs in URL attributes to be blocked")
+	}
+	if !strings.Contains(result, "{@html user.bio}") {
+		t.Error("Expected the raw expression to be kept for the runtime")
+	}
+}
+
+// TestFetchEscapesAttributes tests the fetch library against values that try to break out
+// of an attribute or run script. It evaluates the library with node.
+func TestFetchEscapesAttributes(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+
+	tests := []struct {
+		template string
+		value    string
+		expected string
+	}{
+		{`<a href={v}>x</a>`, "x onmouseover=alert(1)", `<a href=x&#32;onmouseover&#61;alert(1)>x</a>`},
+		{`<a title={v}>x</a>`, "a`b\"c'd", `<a title=a&#96;b&#34;c&#39;d>x</a>`},
+		{`<p class=card {v}>x</p>`, "x onclick=alert(1)", `<p class=card x&#32;onclick&#61;alert(1)>x</p>`},
+		{`<a href="{v}">x</a>`, "java\tscript:alert(1)", `<a href="about:blank">x</a>`},
+		{`<a href="{v}">x</a>`, "\x01 java\nscript:alert(1)", `<a href="about:blank">x</a>`},
+		{`<a href={v}>x</a>`, "JavaScript:alert(1)", `<a href=about:blank>x</a>`},
+		{`<a href='java{v}'>x</a>`, "script:alert(1)", `<a href='javaabout:blank'>x</a>`},
+		{`<a href="{v}">x</a>`, "https://example.com/?a=1&b=2", `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{`<button onclick="{v}">x</button>`, "alert(1)", `<button onclick="">x</button>`},
+		{`<button onmouseover={v}>x</button>`, "alert(1)", `<button onmouseover=>x</button>`},
+		{`<a title="{v}">{v}</a>`, `"><script>`, `<a title="&quot;&gt;&lt;script&gt;">&quot;&gt;&lt;script&gt;</a>`},
+	}
+
+	var script strings.Builder
+	script.WriteString("global.window = {};\n" + gtml.FetchLibrary + "\n")
+	for _, tt := range tests {
+		template, _ := json.Marshal(tt.template)
+		value, _ := json.Marshal(tt.value)
+		script.WriteString(fmt.Sprintf("console.log(JSON.stringify(replaceExpressions(%s, { v: %s })));\n", template, value))
+	}
+	output, err := exec.Command(node, "-e", script.String()).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, output)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("Expected %d results, got: %s", len(tests), output)
+	}
+	for i, tt := range tests {
+		var result string
+		if err := json.Unmarshal([]byte(lines[i]), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result != tt.expected {
+			t.Errorf("%s with %q: expected %s, got %s", tt.template, tt.value, tt.expected, result)
+		}
+	}
+}
+
+// TestFetchValuesAreNotExpressions tests that a fetched value that looks like an expression
+// stays text when a loop item fills in the template again. It evaluates the library with node.
+func TestFetchValuesAreNotExpressions(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+
+	script := "global.window = {};\n" + gtml.FetchLibrary + `
+const list = { title: '{@html user.name}', users: [{ name: '<img src=x onerror=alert(1)>' }] };
+const outer = replaceExpressions('<li>{list.title} {user.name}</li><a title={list.title}>x</a>', { list });
+console.log(replaceExpressions(outer, { list, user: list.users[0] }));
+`
+	output, err := exec.Command(node, "-e", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, output)
+	}
+	expected := `<li>&#123;@html user.name&#125; &lt;img src=x onerror=alert(1)&gt;</li><a title=&#123;@html&#32;user.name&#125;>x</a>`
+	if strings.TrimSpace(string(output)) != expected {
+		t.Errorf("Expected the value to stay text, got: %s", output)
+	}
+
+	result, err := gtml.ProcessFetchElements(`<ul fetch='GET /api/list' as='list'><li for='user in list.users'>{list.title} {user.name}</li></ul>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "const content = gtmlFillTemplate(templateContent, initialScope);") {
+		t.Errorf("Expected for templates to be left out of the first pass, got: %s", result)
+	}
+}
+
+// TestFetchRejectsEventAttributeExpressions tests that data can't be put into event handlers
+func TestFetchRejectsEventAttributeExpressions(t *testing.T) {
+	tests := []string{
+		`<ul fetch='GET /api/users' as='users'><li for='user in users'><button onclick='{user.action}'>Go</button></li></ul>`,
+		`<div fetch='GET /api/user' as='user'><img src='/a.png' onerror={user.name + 1}></div>`,
+		`<div fetch='GET /api/user' as='user'><p fallback><a onMouseOver="go({error.message})">x</a></p></div>`,
+	}
+	for _, html := range tests {
+		if _, err := gtml.ProcessFetchElements(html); err == nil || !strings.Contains(err.Error(), "gtml script") {
+			t.Errorf("Expected an error for an expression in an event attribute: %s, got: %v", html, err)
+		}
+	}
+}
+
+// TestFetchTemplateExpressions tests that fetch template expressions compile to JavaScript
+func TestFetchTemplateExpressions(t *testing.T) {
+	html := `<ul fetch='GET /api/users' as='users'>
+  <li for='user in users' class='{user.active ? "on" : "off"}'>{user.name} is {user.age + 1}, {user.age >= 18 && user.active ? "adult" : "minor"}</li>
+</ul>`
+
+	result, err := gtml.ProcessFetchElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		`roots: ['user'], fn: s => (getValueByPath(s, 'user.active') ? "on" : "off") },`,
+		`roots: ['user'], fn: s => (getValueByPath(s, 'user.age') + 1) },`,
+		`roots: ['user'], fn: s => (((getValueByPath(s, 'user.age') >= 18) && getValueByPath(s, 'user.active')) ? "adult" : "minor") },`,
+		"gtmlFetchExpressions({",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %s, got: %s", expected, result)
+		}
+	}
+
+	// Plain paths are still resolved by the runtime, compiled expressions are referenced by key
+	if !strings.Contains(result, "{user.name} is {#") {
+		t.Errorf("Expected plain paths to stay and expressions to be replaced by keys, got: %s", result)
+	}
+	if strings.Contains(result, "{user.age + 1}") {
+		t.Error("Expected the expression source to be compiled away")
+	}
+}
+
+// TestFetchTopLevelExpressions tests expressions outside for loops
+func TestFetchTopLevelExpressions(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/team' as='team'><h1>{team.name}</h1><p>{team.size == 1 ? "1 member" : "many members"}</p></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	if !strings.Contains(result, "container.innerHTML = replaceExpressions(templateContent, { 'team': team });") {
+		t.Errorf("Expected top level expressions to be filled in, got: %s", result)
+	}
+	if !strings.Contains(result, `(getValueByPath(s, 'team.size') === 1) ? "1 member" : "many members"`) {
+		t.Errorf("Expected == to compile to ===, got: %s", result)
+	}
+}
+
+// TestFetchLiteralBraces tests that braces holding text instead of an expression are kept
+func TestFetchLiteralBraces(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<ul fetch='GET /api/users' as='users'><li for='user in users' data-config='{"theme": "dark"}'>{user.name} <code>{ "a": {"b": 1} }</code> <code>function f() { return 1; }</code></li></ul>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	for _, expected := range []string{`data-config='{"theme": "dark"}'`, `<code>{ "a": {"b": 1} }</code>`, `<code>function f() { return 1; }</code>`} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %s to be kept, got: %s", expected, result)
+		}
+	}
+
+	dir := writeTestProject(t, map[string]string{
+		"data/users.json":   `[{"name": "{Ann}"}]`,
+		"routes/index.html": `<html><body><ul fetch='GET data/users.json' as='users' static><li for='user in users' data-config='{"theme": "dark"}'>{user.name} <code>{ "a": {"b": 1} }</code></li></ul></body></html>`,
+	})
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), `<li data-config='&#123;"theme": "dark"&#125;'>&#123;Ann&#125; <code>&#123; "a": &#123;"b": 1&#125; }</code></li>`) {
+		t.Errorf("Expected literal braces in the static output, got: %s", output)
+	}
+}
+
+// TestFetchNumberLiterals tests that numbers Go parses but JavaScript doesn't are rewritten
+func TestFetchNumberLiterals(t *testing.T) {
+	result, err := gtml.ProcessFetchElements(`<div fetch='GET /api/user' as='user'><p>{user.limit || Inf}</p><p>{user.min || -inf}</p><p>{user.ratio || NaN}</p><p>{user.age + 1.5e3}</p></div>`)
+	if err != nil {
+		t.Fatalf("ProcessFetchElements failed: %v", err)
+	}
+	for _, expected := range []string{
+		"(getValueByPath(s, 'user.limit') || Infinity)",
+		"(getValueByPath(s, 'user.min') || -Infinity)",
+		"(getValueByPath(s, 'user.ratio') || NaN)",
+		"(getValueByPath(s, 'user.age') + 1.5e3)",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %s, got: %s", expected, result)
+		}
+	}
+}
+
+// TestFetchInvalidTemplateExpression tests that unsupported syntax is a compile error
+func TestFetchInvalidTemplateExpression(t *testing.T) {
+	tests := []string{
+		`<div fetch='GET /api/user' as='user'><p>{user.name.toUpperCase()}</p></div>`,
+		`<div fetch='GET /api/user' as='user'><p>{user.admin ? "yes"}</p></div>`,
+		`<div fetch='GET /api/user' as='user'><p>{alert(1) + 1}</p></div>`,
+	}
+
+	for _, html := range tests {
+		if _, err := gtml.ProcessFetchElements(html); err == nil {
+			t.Errorf("Expected error for %s", html)
+		}
+	}
+}
+
+// TestCompileProject_StaticFetch tests fetch elements resolved against local JSON at compile time
+func TestCompileProject_StaticFetch(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"data/teams.json": `[
+  {"id": 1, "name": "Core", "members": ["ann", "bob"], "lead": {"name": "Ann", "site": "javascript:alert(1)"}},
+  {"id": 2, "name": "<Docs>", "members": [], "lead": null}
+]`,
+		"routes/index.html": `<main fetch='GET data/teams.json' as='teams' static>
+  <p suspense>Loading...</p>
+  <p fallback>Failed</p>
+  <h1>{teams.length} teams</h1>
+  <section for='team, t in teams' key='{team.id}' data-index='{t}'>
+    <h2>{t + 1}. {team.name} {loop.last ? "(last)" : ""}</h2>
+    <a href='{team.lead.site}'>{team.lead.name || "nobody"}</a>
+    <label for='name'>Name</label>
+    <span for='member in team.members'>{loop.parent.index}.{loop.index} {member}</span>
+  </section>
+</main>`,
+	})
+
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(output)
+
+	for _, expected := range []string{
+		"<main>",
+		"<h1>2 teams</h1>",
+		"<section data-index='0'>",
+		"<h2>1. Core </h2>",
+		"<h2>2. &lt;Docs&gt; (last)</h2>",
+		"<a href='about:blank'>Ann</a>",
+		">nobody</a>",
+		"<label for='name'>Name</label>",
+		"<span>0.0 ann</span>",
+		"<span>0.1 bob</span>",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %q in the static output, got: %s", expected, result)
+		}
+	}
+	for _, unexpected := range []string{"<script", "Loading...", "Failed", "fetch=", "key=", "static", "1.0"} {
+		if strings.Contains(result, unexpected) {
+			t.Errorf("Expected no %q in the static output, got: %s", unexpected, result)
+		}
+	}
+}
+
+// TestStaticFetchFromURL tests static fetch elements requesting a local server at compile time
+func TestStaticFetchFromURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/users" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"name": "Ann", "age": 30}, {"name": "Bob", "age": 17}]`))
+	}))
+	defer server.Close()
+
+	html := `<ul fetch='GET ` + server.URL + `/api/users' as='users' static><li for='user in users'>{user.name} {user.age >= 18 ? "adult" : "minor"}</li></ul>`
+	if _, err := gtml.ProcessFetchElements(html); err == nil || !strings.Contains(err.Error(), "StaticFetchURLs") {
+		t.Errorf("Expected a url to need StaticFetchURLs, got: %v", err)
+	}
+
+	state := &gtml.GlobalState{Components: map[string]*gtml.Component{}, StaticFetchURLs: true}
+	result, err := gtml.CompileHTML(html, state, map[string]gtml.Value{}, true)
+	if err != nil {
+		t.Fatalf("CompileHTML failed: %v", err)
+	}
+	if result != "<ul><li>Ann adult</li><li>Bob minor</li></ul>" {
+		t.Errorf("Unexpected static output: %s", result)
+	}
+
+	if _, err := gtml.CompileHTML(`<ul fetch='GET `+server.URL+`/api/missing' as='users' static></ul>`, state, map[string]gtml.Value{}, true); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected a failed static fetch to fail with its status, got: %v", err)
+	}
+}
+
+// TestStaticFetchEmptyState tests the empty child of a static fetch element
+func TestStaticFetchEmptyState(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"data/posts.json":   `[]`,
+		"routes/index.html": `<ul fetch='GET data/posts.json' as='posts' static><li empty>No posts yet</li><li for='post in posts'>{post.title}</li></ul>`,
+	})
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "<ul>No posts yet</ul>") {
+		t.Errorf("Expected the empty content, got: %s", output)
+	}
+}
+
+// TestStaticFetchEscapesAttributes tests static rendering against values that try to break
+// out of an attribute or run script
+func TestStaticFetchEscapesAttributes(t *testing.T) {
+	tests := []struct {
+		template string
+		value    string
+		expected string
+	}{
+		{`<a href={d.v}>x</a>`, "x onmouseover=alert(1)", `<a href=x&#32;onmouseover&#61;alert(1)>x</a>`},
+		{`<a title={d.v}>x</a>`, "a`b\"c'd", `<a title=a&#96;b&#34;c&#39;d>x</a>`},
+		{`<p class=card {d.v}>x</p>`, "x onclick=alert(1)", `<p class=card x&#32;onclick&#61;alert(1)>x</p>`},
+		{`<a href="{d.v}">x</a>`, "java\tscript:alert(1)", `<a href="about:blank">x</a>`},
+		{`<a href="{d.v}">x</a>`, "\x01 java\nscript:alert(1)", `<a href="about:blank">x</a>`},
+		{`<a href={d.v}>x</a>`, "JavaScript:alert(1)", `<a href=about:blank>x</a>`},
+		{`<a href='java{d.v}'>x</a>`, "script:alert(1)", `<a href='javaabout:blank'>x</a>`},
+		{`<a href="{d.v}">x</a>`, "https://example.com/?a=1&b=2", `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{`<a title="{d.v}">{d.v}</a>`, `"><script>`, `<a title="&quot;&gt;&lt;script&gt;">&quot;&gt;&lt;script&gt;</a>`},
+	}
+
+	dir := writeTestProject(t, nil)
+	for _, tt := range tests {
+		data, _ := json.Marshal(map[string]string{"v": tt.value})
+		if err := os.WriteFile(filepath.Join(dir, "data.json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		state := &gtml.GlobalState{Components: map[string]*gtml.Component{}, BasePath: dir}
+		result, err := gtml.CompileHTML(`<div fetch='GET data.json' as='d' static>`+tt.template+`</div>`, state, map[string]gtml.Value{}, true)
+		if err != nil {
+			t.Fatalf("CompileHTML failed for %s: %v", tt.template, err)
+		}
+		if result != "<div>"+tt.expected+"</div>" {
+			t.Errorf("%s with %q: expected %s, got %s", tt.template, tt.value, tt.expected, result)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"v": "alert(1)"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state := &gtml.GlobalState{Components: map[string]*gtml.Component{}, BasePath: dir}
+	if _, err := gtml.CompileHTML(`<div fetch='GET data.json' as='d' static><button onclick='{d.v}'>x</button></div>`, state, map[string]gtml.Value{}, true); err == nil || !strings.Contains(err.Error(), "onclick") {
+		t.Errorf("Expected data in an event attribute to fail the build, got: %v", err)
+	}
+}
+
+// TestStaticFetchAttribute tests that only a standalone static attribute marks a fetch element static
+func TestStaticFetchAttribute(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"data/users.json": `[{"name": "Ann"}]`,
+	})
+	tests := []struct {
+		html   string
+		static bool
+	}{
+		{`<ul fetch='GET data/users.json' as='users' static><li for='user in users'>{user.name}</li></ul>`, true},
+		{`<ul static fetch='GET data/users.json' as='users'><li for='user in users'>{user.name}</li></ul>`, true},
+		{`<ul class='card static' fetch='GET data/users.json' as='users'><li for='user in users'>{user.name}</li></ul>`, false},
+		{`<ul fetch='GET data/users.json' as='users' title="is static"><li for='user in users'>{user.name}</li></ul>`, false},
+		{`<ul fetch='GET data/users.json' as='users' data-static='static'><li for='user in users'>{user.name}</li></ul>`, false},
+	}
+	for _, tt := range tests {
+		state := &gtml.GlobalState{Components: map[string]*gtml.Component{}, BasePath: dir}
+		result, err := gtml.CompileHTML(tt.html, state, map[string]gtml.Value{}, true)
+		if err != nil {
+			t.Fatalf("CompileHTML failed for %s: %v", tt.html, err)
+		}
+		if rendered := strings.Contains(result, "<li>Ann</li>"); rendered != tt.static {
+			t.Errorf("%s: expected static %v, got: %s", tt.html, tt.static, result)
+		}
+	}
+}
+
+// TestStaticFetchErrors tests static fetch elements that can't be resolved at compile time
+func TestStaticFetchErrors(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"data/broken.json": `[{"name": `,
+		"data/users.json":  `[{"name": "Ann"}]`,
+	})
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dir), "outside.json"), []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []string{
+		`<ul fetch='GET data/missing.json' as='users' static></ul>`,
+		`<ul fetch='GET data/broken.json' as='users' static></ul>`,
+		`<ul fetch='POST data/users.json' as='users' static></ul>`,
+		`<ul fetch='GET data/users.json' as='users' fetch-interval='5s' static></ul>`,
+		`<ul fetch='GET data/users.json' as='users' fetch-cache static></ul>`,
+		`<ul fetch='GET data/{$file}.json' as='users' static></ul>`,
+		`<ul fetch='GET data/users.json' as='users' static><li for='user in users'>{user.name.toUpperCase()}</li></ul>`,
+		`<ul fetch='GET ../outside.json' as='users' static></ul>`,
+		`<ul fetch='GET data/../../outside.json' as='users' static></ul>`,
+		`<ul fetch='GET /../outside.json' as='users' static></ul>`,
+	}
+	for _, html := range cases {
+		state := &gtml.GlobalState{Components: map[string]*gtml.Component{}, BasePath: dir}
+		if _, err := gtml.CompileHTML(html, state, map[string]gtml.Value{}, true); err == nil {
+			t.Errorf("Expected error for %s", html)
+		}
+	}
+}
+
+// TestFormSubmitsThroughFetch tests forms with a method action
+func TestFormSubmitsThroughFetch(t *testing.T) {
+	html := `<form action='POST /api/login' as='user' class='login' refetch='users, stats'>
+  <input name='email'>
+  <p suspense>Signing in...</p>
+  <p success>Welcome {user.name}</p>
+  <ul fallback='422'><li for='message in error.data.errors'>{message}</li></ul>
+  <p fallback>{error.message}</p>
+</form>`
+
+	result, err := gtml.ProcessFormElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFormElements failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		`<form id="gtml-form-`,
+		`class='login'>`,
+		`<p data-gtml-suspense hidden>Signing in...</p>`,
+		`<p data-gtml-success hidden></p>`,
+		`<ul data-gtml-fallback='422' hidden></ul>`,
+		"const successContent = `Welcome {user.name}`;",
+		"{ status: '422', template: `<li data-gtml-for=\"gtml-for-",
+		"event.preventDefault();",
+		"if (pending) return;",
+		`fetch('/api/login', { method: 'POST', headers: { "Content-Type": "application/json" }, body: JSON.stringify(gtmlFormValues(form, event.submitter)) })`,
+		".then(gtmlReadResponse)",
+		"if (user != null) {",
+		"form.dispatchEvent(new CustomEvent('gtml:success', { detail: user, bubbles: true }));",
+		"refetch('users');\n    refetch('stats');",
+		"const scope = { error: { message: error.message, status, data: error.data }, status };",
+		"function gtmlFormValues(form, submitter)",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %s, got: %s", expected, result)
+		}
+	}
+	for _, removed := range []string{"action=", "as='user'", "refetch="} {
+		if strings.Contains(result[:strings.Index(result, "<script>")], removed) {
+			t.Errorf("Expected %s to be removed from the form", removed)
+		}
+	}
+}
+
+// TestFormRequestBodies tests how each kind of form sends its fields
+func TestFormRequestBodies(t *testing.T) {
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{
+			`<form action='GET /api/search'><input name='q'></form>`,
+			"fetch(gtmlFormURL('/api/search', form, event.submitter), { method: 'GET' })",
+		},
+		{
+			`<form action='POST /api/avatar' enctype='multipart/form-data'><input type='file' name='avatar'></form>`,
+			"fetch('/api/avatar', { method: 'POST', body: new FormData(form, event.submitter) })",
+		},
+		{
+			`<form action='PUT /api/users/{$userId}' fetch-headers='Content-Type: application/x-json'><input name='name'></form>`,
+			"fetch(`/api/users/${encodeURIComponent(_s.get('userId') ?? '')}`, { method: 'PUT', headers: { \"Content-Type\": \"application/x-json\" }, body: JSON.stringify(gtmlFormValues(form, event.submitter)) })",
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := gtml.ProcessFormElements(tt.html)
+		if err != nil {
+			t.Fatalf("ProcessFormElements failed for %s: %v", tt.html, err)
+		}
+		if !strings.Contains(result, tt.expected) {
+			t.Errorf("Expected %s, got: %s", tt.expected, result)
+		}
+	}
+}
+
+// TestFormPlainActionUntouched tests that forms without a method action submit normally
+func TestFormPlainActionUntouched(t *testing.T) {
+	html := `<form action='/search' method='get'><input name='q'></form>`
+	result, err := gtml.ProcessFormElements(html)
+	if err != nil {
+		t.Fatalf("ProcessFormElements failed: %v", err)
+	}
+	if result != html {
+		t.Errorf("Expected the form to be unchanged, got: %s", result)
+	}
+}
+
+// TestFormErrors tests validation of enhanced forms
+func TestFormErrors(t *testing.T) {
+	tests := []string{
+		`<form action='/api/login' as='user'></form>`,
+		`<form action='POST /api/login' fetch-body='{"a": 1}'></form>`,
+		`<form action='POST /api/login' fetch-cache></form>`,
+		`<form action='POST /api/login' refetch='users-list'></form>`,
+		`<form action='POST /api/login'><p fallback='4x'>oops</p></form>`,
+		`<form action='POST /api/login'><p success>one</p><p success>two</p></form>`,
+	}
+
+	for _, html := range tests {
+		if _, err := gtml.ProcessFormElements(html); err == nil {
+			t.Errorf("Expected error for %s", html)
+		}
+	}
+}
+
+// TestCompileProject_FormInComponent tests a form whose action comes from a prop
+func TestCompileProject_FormInComponent(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/SignIn.html": `<div props='action string, label string'>
+  <form action='{action}' as='result'>
+    <button>{label}</button>
+    <p success>Hi {result.name}</p>
+    <p fallback>{error.message}</p>
+  </form>
+</div>`,
+		"routes/index.html": `<html><body><SignIn action='POST /api/login' label='Sign in' /></body></html>`,
+	})
+
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(out)
+
+	for _, expected := range []string{
+		"<button>Sign in</button>",
+		"const successContent = `Hi {result.name}`;",
+		"{ status: '', template: `{error.message}`, el: fallbackEls[0] },",
+		"fetch('/api/login', { method: 'POST'",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %s, got: %s", expected, result)
+		}
+	}
+}
+
+// TestCompileProject_PreinstalledFormsAction tests the preinstalled forms submit to their action through fetch
+func TestCompileProject_PreinstalledFormsAction(t *testing.T) {
+	files := map[string]string{
+		"routes/index.html": `<html><body>
+<LoginForm action='POST /api/login' emailPlaceholder='Email' passwordPlaceholder='Password' rememberLabel='Remember me' forgotPasswordLabel='Forgot?' submitLabel='Sign in' />
+<FormLayout action='POST /api/contact' title='Contact' description='' fields='' submitText='Send' />
+</body></html>`,
+	}
+	for _, name := range []string{"LoginForm", "FormLayout"} {
+		template, err := os.ReadFile(filepath.Join("..", "spec", "components", "preinstalled_components", "forms", name+".html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["components/"+name+".html"] = string(template)
+	}
+
+	dir := writeTestProject(t, files)
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	out, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"fetch('/api/login', { method: 'POST'", "fetch('/api/contact', { method: 'POST'", "Signing in...", "Sending..."} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("Expected %s, got: %s", expected, out)
+		}
+	}
+	if strings.Contains(string(out), "action=") {
+		t.Errorf("Expected the form actions to be compiled away, got: %s", out)
+	}
+
+	// action is a required prop like any other
+	files["routes/index.html"] = `<html><body><FormLayout title='Contact' description='' fields='' submitText='Send' /></body></html>`
+	if err := gtml.CompileProject(writeTestProject(t, files), testCompileOptions()); err == nil {
+		t.Error("Expected a FormLayout without an action to fail to compile")
+	}
+}
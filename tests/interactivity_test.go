@@ -0,0 +1,658 @@
+package main_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/gtml/pkg/gtml"
+)
+
+const counterComponent = `<div props='start int'>
+  <p>{$count}</p>
+  <button id='inc'>+</button>
+  <script type='gtml'>
+    $count = $start
+    #inc.onclick(() => {
+      $count = $count + 1
+    })
+  </script>
+</div>`
+
+func TestInteractivity_InstancesGetDistinctScopes(t *testing.T) {
+	state := createTestState(map[string]string{"Counter": counterComponent})
+
+	result, err := gtml.CompileHTML(`<main><Counter start={1} /><Counter start={5} /></main>`, state, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids := regexpAll(`data-gtml-instance='([^']+)'`, result)
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Fatalf("expected two distinct instance ids, got %v", ids)
+	}
+	for i, start := range []string{"1", "5"} {
+		id := ids[i]
+		if !strings.Contains(result, "<span data-gtml-signal-value='"+id+":count'></span>") {
+			t.Errorf("expected placeholder keyed by %s, got: %s", id, result)
+		}
+		if !strings.Contains(result, "gtmlScope('"+id+"');\n  _s.init('count', null);\n  _s.init('start', "+start+");") {
+			t.Errorf("expected instance %s to initialize its own signals, got: %s", id, result)
+		}
+	}
+}
+
+func TestInteractivity_SelectorsAreInstanceRelative(t *testing.T) {
+	compiled, signals := gtml.CompileGtmlScript("#inc.onclick(() => {\n  $count = $count + 1\n});\n.item*.forEach(el => el.remove())\n#.focus()")
+
+	for _, expected := range []string{
+		"_s.$('#inc').onclick = () => {",
+		"_s.set('count', _s.get('count') + 1)",
+		"_s.$$('.item').forEach",
+		"_s.root.focus()",
+	} {
+		if !strings.Contains(compiled, expected) {
+			t.Errorf("expected %q in compiled script, got: %s", expected, compiled)
+		}
+	}
+	if !signals["count"] {
+		t.Errorf("expected count to be reported as a signal, got %v", signals)
+	}
+}
+
+func TestInteractivity_InlineEvents(t *testing.T) {
+	html := `<div><p>{$count}</p><button onclick={() => {
+    $count = $count + 1
+  }}>+</button></div>`
+
+	result, script, err := gtml.ProcessInlineEvents(html, map[string]gtml.Value{"count": {Type: gtml.PropTypeInt, IntVal: 3}}, "i9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key := regexpAll(`data-gtml-on-click='([0-9]+)'`, result)
+	if len(key) != 1 || strings.Contains(result, "onclick") {
+		t.Fatalf("expected onclick to be replaced by a keyed attribute, got: %s", result)
+	}
+	if !strings.Contains(result, "<span data-gtml-signal-value='i9:count'></span>") {
+		t.Errorf("expected scoped placeholder, got: %s", result)
+	}
+	if !strings.Contains(script, "_s.init('count', 3);") || !strings.Contains(script, "_s.bindEvent('click', '"+key[0]+"', function(event) {") {
+		t.Errorf("expected scoped init and event binding, got: %s", script)
+	}
+}
+
+func TestInteractivity_StaticComponentsHaveNoInstance(t *testing.T) {
+	state := createTestState(map[string]string{"Card": `<div props='title string'><h2>{title}</h2></div>`})
+
+	result, err := gtml.CompileHTML(`<Card title='Hi' />`, state, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(result, "data-gtml-instance") || strings.Contains(result, "<script>") {
+		t.Errorf("expected static component to compile without interactivity, got: %s", result)
+	}
+}
+
+// regexpAll returns the first capture group of every match
+func regexpAll(pattern string, s string) []string {
+	var values []string
+	for _, match := range regexp.MustCompile(pattern).FindAllStringSubmatch(s, -1) {
+		values = append(values, match[1])
+	}
+	return values
+}
+
+func TestInteractivity_ComputedSignals(t *testing.T) {
+	compiled, signals := gtml.CompileGtmlScript("$total := $price * $qty")
+
+	expected := "_s.computed('total', () => (_s.get('price') * _s.get('qty')))"
+	if compiled != expected {
+		t.Errorf("expected %q, got %q", expected, compiled)
+	}
+	for _, name := range []string{"total", "price", "qty"} {
+		if !signals[name] {
+			t.Errorf("expected %s to be reported as a signal, got %v", name, signals)
+		}
+	}
+}
+
+func TestInteractivity_Effects(t *testing.T) {
+	compiled, _ := gtml.CompileGtmlScript("effect(() => {\n  console.log($total)\n})\n#btn.onclick(() => {\n  $total = 0\n})")
+
+	for _, expected := range []string{
+		"_s.effect(() => {\n  console.log(_s.get('total'))\n})",
+		"_s.$('#btn').onclick = () => {\n  _s.set('total', 0)\n};",
+	} {
+		if !strings.Contains(compiled, expected) {
+			t.Errorf("expected %q in compiled script, got: %s", expected, compiled)
+		}
+	}
+}
+
+func TestInteractivity_RuntimeTracksDependencies(t *testing.T) {
+	for _, expected := range []string{"class GtmlEffect", "function gtmlEffect(fn)", "function gtmlComputed(fn", "computed(name, fn)", "_gtmlActiveEffect.track(this)"} {
+		if !strings.Contains(gtml.SignalLibrary, expected) {
+			t.Errorf("expected signal library to contain %q", expected)
+		}
+	}
+}
+
+func TestInteractivity_AttributeBindings(t *testing.T) {
+	html := `<div size='lg' class='item {size} {$isOpen ? "open" : ""}'><button disabled={$loading}>Go</button></div>`
+
+	result, script, err := gtml.ProcessSignalBindings(html, map[string]gtml.Value{"size": {Type: gtml.PropTypeString, StrVal: "lg"}}, "i4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := regexpAll(`data-gtml-bind='([0-9]+)'`, result)
+	if len(keys) != 2 {
+		t.Fatalf("expected both elements to be bound, got: %s", result)
+	}
+	if !strings.Contains(result, "class='item lg'") {
+		t.Errorf("expected static class text to be kept, got: %s", result)
+	}
+	if strings.Contains(result, "disabled") || strings.Contains(result, "{$") {
+		t.Errorf("expected signal expressions to be removed from markup, got: %s", result)
+	}
+	for _, expected := range []string{
+		"_s.bindAttr('" + keys[0] + "', 'class', () => `item lg ${(_s.get('isOpen') ? \"open\" : \"\") ?? ''}`);",
+		"_s.bindAttr('" + keys[1] + "', 'disabled', () => (_s.get('loading')));",
+		"_s.init('isOpen', null);",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %q in script, got: %s", expected, script)
+		}
+	}
+}
+
+func TestInteractivity_TextBindings(t *testing.T) {
+	html := `<p>{$count}</p><p>{$isOn ? "ON" : "OFF"}</p><script>const s = "{$raw}";</script>`
+
+	result, script, err := gtml.ProcessSignalBindings(html, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(result, "<p><span data-gtml-signal-value='count'></span></p>") {
+		t.Errorf("expected simple reads to use signal placeholders, got: %s", result)
+	}
+	keys := regexpAll(`<span data-gtml-bind='([0-9]+)'></span>`, result)
+	if len(keys) != 1 || !strings.Contains(script, "_s.bindText('"+keys[0]+"', () => (_s.get('isOn') ? \"ON\" : \"OFF\"));") {
+		t.Errorf("expected a text binding, got: %s\n%s", result, script)
+	}
+	if !strings.Contains(result, `const s = "{$raw}";`) {
+		t.Errorf("expected script contents to be left alone, got: %s", result)
+	}
+}
+
+func TestInteractivity_ComponentWithBindingsCompiles(t *testing.T) {
+	state := createTestState(map[string]string{"Toggle": `<button class='toggle {$on ? "on" : ""}' onclick={() => {
+    $on = !$on
+  }}>{$on ? "ON" : "OFF"}</button>`})
+
+	result, err := gtml.CompileHTML(`<Toggle />`, state, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "class='toggle'") || !strings.Contains(result, "_s.bindAttr(") || !strings.Contains(result, "_s.bindText(") {
+		t.Errorf("expected reactive class and text bindings, got: %s", result)
+	}
+}
+
+func TestInteractivity_InputBindings(t *testing.T) {
+	html := `<form><input type='text' bind:value={$name} /><input type='checkbox' bind:checked='{$agree}'></form>`
+
+	result, script, err := gtml.ProcessSignalBindings(html, map[string]gtml.Value{"name": {Type: gtml.PropTypeString, StrVal: "Ada"}}, "i2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := regexpAll(`data-gtml-bind='([0-9]+)'`, result)
+	if len(keys) != 2 || strings.Contains(result, "bind:") {
+		t.Fatalf("expected bind directives to be replaced by binding keys, got: %s", result)
+	}
+	for _, expected := range []string{
+		"_s.init('name', \"Ada\");",
+		"_s.bindInput('" + keys[0] + "', 'value', 'name');",
+		"_s.bindInput('" + keys[1] + "', 'checked', 'agree');",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %q in script, got: %s", expected, script)
+		}
+	}
+}
+
+func TestInteractivity_InvalidInputBindings(t *testing.T) {
+	for _, html := range []string{
+		`<input bind:placeholder={$name} />`,
+		`<input bind:value={$first + $last} />`,
+	} {
+		if _, _, err := gtml.ProcessSignalBindings(html, nil, ""); err == nil {
+			t.Errorf("expected an error for %s", html)
+		}
+	}
+}
+
+func TestInteractivity_ReactiveLists(t *testing.T) {
+	html := `<ul><li for='todo in $todos' key={todo.id} class='{size}'>{todo.text}<button onclick={() => {
+    $todos = $todos.filter(t => t.id !== todo.id)
+  }}>x</button></li></ul>`
+	props := map[string]gtml.Value{"size": {Type: gtml.PropTypeString, StrVal: "sm"}}
+
+	html, eventScript, err := gtml.ProcessInlineEvents(html, props, "i1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(eventScript, "const todo = _gtmlLoopValue(this, 'todo');") {
+		t.Errorf("expected the handler to read the loop item, got: %s", eventScript)
+	}
+
+	result, script, err := gtml.ProcessSignalBindings(html, props, "i1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := regexpAll(`<template data-gtml-list='([0-9]+)'></template>`, result)
+	if len(keys) != 1 || strings.Contains(result, "<li") {
+		t.Fatalf("expected the list element to be replaced by an anchor, got: %s", result)
+	}
+	expected := "_s.bindList('" + keys[0] + "', 'todo', 'todos', \"id\", \"\\u003cli class='sm'\\u003e{todo.text}\\u003cbutton data-gtml-on-click="
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected %q in script, got: %s", expected, script)
+	}
+}
+
+func TestInteractivity_ReactiveListExpressions(t *testing.T) {
+	html := `<li for='todo in $todos' class='{$sel === todo.id ? "sel" : ""}'>{todo.text} {todo.done ? 'done' : 'open'}<i if={todo.late}>late</i></li>`
+	_, script, err := gtml.ProcessSignalBindings(html, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`"\u003cli class='{#0}'\u003e{todo.text} {#1}\u003ci data-gtml-if='{#2}'\u003elate\u003c/i\u003e\u003c/li\u003e"`,
+		`[(todo) => (_s.get('sel') === todo.id ? "sel" : ""), (todo) => (todo.done ? 'done' : 'open'), (todo) => (!!(todo.late))]`,
+		`_s.init('sel', null);`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %s in script, got: %s", expected, script)
+		}
+	}
+
+	if _, _, err := gtml.ProcessSignalBindings(`<li for='todo in $todos'>{ todo.done ? (<s>x</s>) : (<b>y</b>) }</li>`, nil, ""); err == nil {
+		t.Error("expected an error for markup in a list item expression")
+	}
+}
+
+func TestInteractivity_ReactiveListTernaryBranches(t *testing.T) {
+	result, err := gtml.CompileHTML(`<ul><li for='todo in $todos'>{ todo.done ? (<s>{todo.text}</s>) : (<b>{todo.text}</b>) }</li></ul>`, createTestState(nil), nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `"\u003cli\u003e\u003cs data-gtml-if='{#0}'\u003e{todo.text}\u003c/s\u003e\u003cb data-gtml-if='{#1}'\u003e{todo.text}\u003c/b\u003e\u003c/li\u003e", [(todo) => (!!(todo.done)), (todo) => (!!(!(todo.done)))]`
+	if !strings.Contains(result, expected) {
+		t.Errorf("expected the ternary on the item to become conditional branches, got: %s", result)
+	}
+}
+
+func TestInteractivity_ArrayMethodsNotify(t *testing.T) {
+	compiled, _ := gtml.CompileGtmlScript(`$todos.push({ id: $next }); $todos.length`)
+	expected := `_s.mutate('todos', v => v.push({ id: _s.get('next') })); _s.get('todos').length`
+	if compiled != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, compiled)
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	script := "global.document = { documentElement: {}, querySelectorAll: () => [] };\n" + gtml.SignalLibrary + `
+const _s = gtmlScope('');
+_s.init('todos', [{ id: 1 }]);
+_s.init('next', 2);
+const lengths = [];
+_s.effect(() => lengths.push(_s.get('todos').length));
+` + compiled + `;
+console.log(lengths.join(','));
+`
+	output, err := exec.Command(node, "-e", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, output)
+	}
+	if strings.TrimSpace(string(output)) != "1,2" {
+		t.Errorf("expected appending to re-run effects on the list, got: %s", output)
+	}
+}
+
+func TestInteractivity_ReactiveListWithoutKey(t *testing.T) {
+	_, script, err := gtml.ProcessSignalBindings(`<p for='tag in $tags'>{tag}</p>`, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(script, "_s.bindList(") || !strings.Contains(script, "'tag', 'tags', null,") {
+		t.Errorf("expected items to be keyed by identity, got: %s", script)
+	}
+}
+
+func TestInteractivity_ReactiveListInvalidKey(t *testing.T) {
+	if _, _, err := gtml.ProcessSignalBindings(`<p for='tag in $tags' key={other.id}>{tag}</p>`, nil, ""); err == nil {
+		t.Error("expected an error for a key that does not use the loop item")
+	}
+}
+
+func TestInteractivity_FetchLoopsAreNotReactive(t *testing.T) {
+	html := `<label for='email'>Email</label><li for='user in users'>{user.name}</li>`
+	result, script, err := gtml.ProcessSignalBindings(html, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != html || script != "" {
+		t.Errorf("expected non-signal for attributes to be left alone, got: %s %s", result, script)
+	}
+}
+
+func TestInteractivity_IfAttribute(t *testing.T) {
+	result, script, err := gtml.ProcessSignalBindings(`<section class='body' if={$open}>Body</section>`, nil, "i3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := regexpAll(`data-gtml-bind='([0-9]+)' style='display: none'`, result)
+	if len(keys) != 1 || strings.Contains(result, "if=") {
+		t.Fatalf("expected a hidden bound element, got: %s", result)
+	}
+	if !strings.Contains(script, "_s.bindIf('"+keys[0]+"', () => (_s.get('open')));") {
+		t.Errorf("expected a conditional binding, got: %s", script)
+	}
+}
+
+func TestInteractivity_IfKeepsOwnStyle(t *testing.T) {
+	result, _, err := gtml.ProcessSignalBindings(`<nav style="display: flex" if={$open}>Menu</nav><p if={$open} style='color: {$color}'>Hi</p>`, nil, "i3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !regexp.MustCompile(`<nav data-gtml-bind='[0-9]+' style='display: none' data-gtml-style="display: flex">Menu</nav>`).MatchString(result) {
+		t.Errorf("expected the element's own style to be kept for the runtime, got: %s", result)
+	}
+	if strings.Count(result, " style=") != 2 || strings.Contains(result, " hidden") {
+		t.Errorf("expected one style attribute per element, got: %s", result)
+	}
+	if !strings.Contains(gtml.SignalLibrary, "if (el.getAttribute('style') !== 'display: none') return;") {
+		t.Error("expected the runtime to leave styles set by a binding alone")
+	}
+}
+
+func TestInteractivity_SignalTernaries(t *testing.T) {
+	state := createTestState(map[string]string{
+		"Login": `<button>Log in</button>`,
+		"Gate":  `<div props='user string'>{ $loggedIn ? (<p>Welcome {user}</p>) : (<Login />) }</div>`,
+	})
+
+	result, err := gtml.CompileHTML(`<Gate user='Ada' />`, state, nil, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := regexpAll(`data-gtml-bind='([0-9]+)' style='display: none'`, result)
+	if len(keys) != 2 {
+		t.Fatalf("expected both branches to be rendered hidden, got: %s", result)
+	}
+	for _, expected := range []string{
+		"<p data-gtml-bind='" + keys[0] + "' style='display: none'>Welcome Ada</p>",
+		"<div data-gtml-bind='" + keys[1] + "' style='display: none' data-gtml-style='display: contents'><button>Log in</button></div>",
+		"_s.bindIf('" + keys[0] + "', () => (_s.get('loggedIn')));",
+		"_s.bindIf('" + keys[1] + "', () => (!(_s.get('loggedIn'))));",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("expected %q in output, got: %s", expected, result)
+		}
+	}
+}
+
+func TestInteractivity_StaticTernariesStillCompileTime(t *testing.T) {
+	state := createTestState(nil)
+	result, err := gtml.CompileHTML(`<div>{ true ? (<p>yes</p>) : (<p>no</p>) }</div>`, state, map[string]gtml.Value{}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if normalizeHTML(result) != "<div><p>yes</p></div>" {
+		t.Errorf("expected the ternary to be resolved at compile time, got: %s", result)
+	}
+}
+
+func TestCompileGtmlScript_PreservesJavaScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"ordinary callbacks", "items.forEach(x => {\n  console.log(x)\n});", "items.forEach(x => {\n  console.log(x)\n});"},
+		{"selectors in strings", `const s = "#btn .foo"; const t = '$x = 1'`, `const s = "#btn .foo"; const t = '$x = 1'`},
+		{"comments", "// #btn.onclick($x = 1)\n/* .foo */ run()", "// #btn.onclick($x = 1)\n/* .foo */ run()"},
+		{"regex literals", "const r = /#a.b$/g", "const r = /#a.b$/g"},
+		{"method chains", "el.classList.add('x'); arr.map(a => a.id).filter(Boolean)", "el.classList.add('x'); arr.map(a => a.id).filter(Boolean)"},
+		{"private and member names", "foo.$bar = this.#priv", "foo.$bar = this.#priv"},
+		{"template literals", "$msg = `hi ${$name}.cls #x`", "_s.set('msg', `hi ${_s.get('name')}.cls #x`)"},
+		{"methods starting with on", "emitter.once(fn); $.one('click', fn); socket.onmessage(fn)", "emitter.once(fn); $.one('click', fn); socket.onmessage(fn)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := gtml.CompileGtmlScript(tt.input)
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCompileGtmlScript_SignalAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#red.onclick(() => { $color = "red" })`, `_s.$('#red').onclick = () => { _s.set('color', "red") };`},
+		{"$a = 1, $b = 2", "_s.set('a', 1), _s.set('b', 2)"},
+		{"$x = $y ? 1 : 2; $z++", "_s.set('x', _s.get('y') ? 1 : 2); _s.set('z', _s.get('z') + 1)"},
+		{"$total += $price * 2", "_s.set('total', _s.get('total') + (_s.get('price') * 2))"},
+		{"$ok = $a === $b", "_s.set('ok', _s.get('a') === _s.get('b'))"},
+		{"$sum = $a +\n  $b\n$next = 1", "_s.set('sum', _s.get('a') +\n  _s.get('b'))\n_s.set('next', 1)"},
+		{"$n = $c\n  .toFixed(2)", "_s.set('n', _s.get('c')\n  .toFixed(2))"},
+		{"$n = 1 // one\n$m = 2", "_s.set('n', 1) // one\n_s.set('m', 2)"},
+	}
+
+	for _, tt := range tests {
+		result, _ := gtml.CompileGtmlScript(tt.input)
+		if result != tt.expected {
+			t.Errorf("input %q\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestInteractivity_PersistedSignals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"$theme = persist('light')", "_s.persist('theme', 'light')"},
+		{"$step = persist ($step, { storage: 'session', key: 'wizard' })", "_s.persist('step', _s.get('step'), { storage: 'session', key: 'wizard' })"},
+		{"$theme = persist('a') + 'b'", "_s.set('theme', persist('a') + 'b')"},
+	}
+
+	for _, tt := range tests {
+		result, _ := gtml.CompileGtmlScript(tt.input)
+		if result != tt.expected {
+			t.Errorf("input %q\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, result)
+		}
+	}
+
+	for _, expected := range []string{"function persistSignal(name, initialValue, options = {})", "persist(name, initialValue, options = {})"} {
+		if !strings.Contains(gtml.SignalLibrary, expected) {
+			t.Errorf("expected signal library to contain %q", expected)
+		}
+	}
+}
+
+func TestInteractivity_PersistedSignalsShareKey(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	script := `const store = new Map();
+global.window = { localStorage: { getItem: k => store.has(k) ? store.get(k) : null, setItem: (k, v) => store.set(k, v) } };
+global.document = { documentElement: {}, querySelector: () => null, querySelectorAll: () => [] };
+` + gtml.SignalLibrary + `
+const first = gtmlScope('i1');
+const second = gtmlScope('i2');
+first.persist('theme', 'light');
+second.persist('theme', 'light');
+first.set('theme', 'dark');
+const a = second.get('theme');
+second.set('theme', 'blue');
+console.log([a, first.get('theme'), store.get('gtml:theme')].join(' '));
+`
+	output, err := exec.Command(node, "-e", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("node failed: %v\n%s", err, output)
+	}
+	if strings.TrimSpace(string(output)) != `dark blue "blue"` {
+		t.Errorf("expected instances with the same key to stay in sync, got: %s", output)
+	}
+}
+
+func TestInteractivity_EmitAndOn(t *testing.T) {
+	compiled, _ := gtml.CompileGtmlScript("#add.onclick(() => emit('cart:add', { id: 1 }))\non('cart:add', item => {\n  $count++\n})\nbus.emit('x'); bus.on('y')")
+
+	for _, expected := range []string{
+		"_s.$('#add').onclick = () => _s.emit('cart:add', { id: 1 });",
+		"_s.on('cart:add', item => {",
+		"bus.emit('x'); bus.on('y')",
+	} {
+		if !strings.Contains(compiled, expected) {
+			t.Errorf("expected %q in compiled script, got: %s", expected, compiled)
+		}
+	}
+}
+
+func TestParseEmitsAttribute(t *testing.T) {
+	emits, template, err := gtml.ParseEmitsAttribute(`<div emits='cart:add, cart:remove' class='card'></div>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(emits, ",") != "cart:add,cart:remove" {
+		t.Errorf("expected both events, got %v", emits)
+	}
+	if template != `<div class='card'></div>` {
+		t.Errorf("expected emits to be removed, got: %s", template)
+	}
+
+	for _, invalid := range []string{`<div emits='a, a'></div>`, `<div emits='bad name'></div>`, `<div emits='a'><p emits='b'></p></div>`} {
+		if _, _, err := gtml.ParseEmitsAttribute(invalid); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestEmittedEvents(t *testing.T) {
+	template := `<div><button onclick={() => { emit("cart:remove") }}>x</button><script type='gtml'>
+  // emit('commented')
+  const label = "emit('quoted')"
+  #add.onclick(() => emit('cart:add', $item))
+</script></div>`
+
+	events := gtml.EmittedEvents(template)
+	if strings.Join(events, ",") != "cart:add,cart:remove" {
+		t.Errorf("expected emitted events from scripts and inline events, got %v", events)
+	}
+	if err := gtml.ValidateEmits("Card", template, []string{"cart:add"}); err == nil || !strings.Contains(err.Error(), "cart:remove") {
+		t.Errorf("expected an undeclared event error, got %v", err)
+	}
+}
+
+func TestValidateEmits_DynamicNames(t *testing.T) {
+	for _, code := range []string{"emit(name)", "emit('cart:' + kind, 1)", "emit(`cart:${kind}`)"} {
+		template := `<div><script type='gtml'>` + code + `</script></div>`
+		if err := gtml.ValidateEmits("Card", template, []string{"cart:add"}); err == nil || !strings.Contains(err.Error(), "string literals") {
+			t.Errorf("expected an error for %s, got %v", code, err)
+		}
+	}
+
+	template := "<div><script type='gtml'>emit(`cart:add`, $item)</script></div>"
+	if err := gtml.ValidateEmits("Card", template, []string{"cart:add"}); err != nil {
+		t.Errorf("expected a template literal without substitutions to be checked like a string, got %v", err)
+	}
+}
+
+func TestCompileProject_CrossComponentEvents(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/ProductCard.html": `<div emits='cart:add'><button id='add'>Add</button><script type='gtml'>
+  #add.onclick(() => emit('cart:add', { id: 1 }))
+</script></div>`,
+		"components/CartBadge.html": `<span>{$count}<script type='gtml'>
+  $count = 0
+  on('cart:add', () => {
+    $count++
+  })
+</script></span>`,
+		"routes/index.html": `<main><ProductCard /><CartBadge /></main>`,
+	})
+
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), "emits=") || !strings.Contains(string(index), "_s.emit('cart:add'") || !strings.Contains(string(index), "_s.on('cart:add'") {
+		t.Errorf("expected compiled emit and on calls, got: %s", index)
+	}
+
+	undeclared := writeTestProject(t, map[string]string{
+		"components/ProductCard.html": `<div><button onclick={() => { emit('cart:add') }}>Add</button></div>`,
+		"routes/index.html":           `<main><ProductCard /></main>`,
+	})
+	if err := gtml.CompileProject(undeclared, testCompileOptions()); err == nil || !strings.Contains(err.Error(), "does not declare it in emits") {
+		t.Errorf("expected an undeclared emit error, got %v", err)
+	}
+}
+
+func TestInteractivity_ReservedScopeFunctionNames(t *testing.T) {
+	for _, script := range []string{
+		"function on(name) { console.log(name) }",
+		"const emit = () => {}",
+		"let effect = 1",
+		"items.forEach(refetch => refetch.run())",
+		"items.forEach((item, on) => {})",
+		"function handle(a, emit) {}",
+		"try { run() } catch (effect) {}",
+	} {
+		html := `<div><button id='btn'>Go</button><script type='gtml'>` + script + `</script></div>`
+		if _, _, err := gtml.ProcessGtmlScripts(html, map[string]gtml.Value{}, "i1"); err == nil {
+			t.Errorf("expected an error for %q", script)
+		}
+	}
+
+	for _, script := range []string{
+		"on('cart:add', item => emit('saved', item))",
+		"items.forEach((item, i = on('x')) => {})",
+		"if (ready) { refetch('users') }",
+		"const handlers = { on: 1 }; bus.on('x'); effect(() => {})",
+	} {
+		html := `<div><script type='gtml'>` + script + `</script></div>`
+		if _, _, err := gtml.ProcessGtmlScripts(html, map[string]gtml.Value{}, "i1"); err != nil {
+			t.Errorf("unexpected error for %q: %v", script, err)
+		}
+	}
+}
+
+func TestCompileGtmlScript_Refetch(t *testing.T) {
+	result, _ := gtml.CompileGtmlScript("#reload.onclick(() => refetch('users'))")
+	if !strings.Contains(result, "_s.refetch('users')") {
+		t.Errorf("Expected refetch to run against the instance scope, got: %s", result)
+	}
+}
@@ -0,0 +1,153 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phillip-england/gtml/pkg/gtml"
+)
+
+func TestMinifyHTML_CollapsesWhitespace(t *testing.T) {
+	input := `<div>
+    <!-- a comment -->
+    <p>Hello    world</p>
+  </div>`
+	expected := `<div> <p>Hello world</p> </div>`
+
+	if result := gtml.MinifyHTML(input); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestMinifyHTML_PreservesPreAndTextarea(t *testing.T) {
+	input := `<div>
+  <pre>  line one
+    line two</pre>
+  <textarea>  keep   me  </textarea>
+</div>`
+
+	result := gtml.MinifyHTML(input)
+	if !strings.Contains(result, "<pre>  line one\n    line two</pre>") {
+		t.Errorf("expected pre content to be preserved, got: %s", result)
+	}
+	if !strings.Contains(result, "<textarea>  keep   me  </textarea>") {
+		t.Errorf("expected textarea content to be preserved, got: %s", result)
+	}
+}
+
+func TestMinifyHTML_MinifiesScriptsAndStyles(t *testing.T) {
+	input := `<style>
+  /* heading */
+  h1 {
+    color: red;
+  }
+</style>
+<script>
+  // say hello
+  const greeting = 'hi   there';
+  console.log(greeting);
+</script>
+<script type="application/json">{ "keep":   true }</script>`
+
+	result := gtml.MinifyHTML(input)
+	if !strings.Contains(result, "<style>h1{color:red}</style>") {
+		t.Errorf("expected style block to be minified, got: %s", result)
+	}
+	if !strings.Contains(result, "<script>const greeting='hi   there';console.log(greeting);</script>") {
+		t.Errorf("expected script block to be minified, got: %s", result)
+	}
+	if !strings.Contains(result, `{ "keep":   true }`) {
+		t.Errorf("expected non-JavaScript script to be preserved, got: %s", result)
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	input := `/* comment */
+.a > .b ,  .c:hover {
+  color: red;
+  content: "a  b";
+}`
+	expected := `.a>.b,.c:hover{color:red;content:"a  b"}`
+
+	if result := gtml.MinifyCSS(input); result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestMinifyCSS_ManyRules(t *testing.T) {
+	input := strings.Repeat(".a { color: red; }\n@media (min-width: 1px) { .b { margin: 0; } }\n", 20000)
+	expected := strings.Repeat(".a{color:red}@media (min-width:1px){.b{margin:0}}", 20000)
+
+	if result := gtml.MinifyCSS(input); result != expected {
+		t.Errorf("expected every rule to lose its trailing semicolon, got %d bytes", len(result))
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; // one\nlet b = 2;", "let a=1;let b=2;"},
+		{"/* block */\nconst s = \"// not a comment\";", "const s=\"// not a comment\";"},
+		{"const t = `keep  ${ a + `nested` }  spacing`;", "const t=`keep  ${ a + `nested` }  spacing`;"},
+		{"const r = /\\/\\/ [}]/g;", "const r=/\\/\\/ [}]/g;"},
+		{"const half = total / 2 / 1;", "const half=total / 2 / 1;"},
+		{"a = b\nc = d", "a=b\nc=d"},
+		{"if (x) /a  b/.test(s) && go();", "if(x)/a  b/.test(s)&&go();"},
+		{"while (ok(\"(\")) /'/.exec(s);", "while(ok(\"(\"))/'/.exec(s);"},
+		{"const r = f(a) / 2 / g(b);", "const r=f(a)/ 2 / g(b);"},
+		{"x.if(a) / 2 / b;", "x.if(a)/ 2 / b;"},
+	}
+
+	for _, tt := range tests {
+		if result := gtml.MinifyJS(tt.input); result != tt.expected {
+			t.Errorf("MinifyJS(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestCompileProject_Minify(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"components/Layout.html": `<style>
+  p { color: red; }
+</style>
+<html>
+  <head>
+    <title>Site</title>
+  </head>
+  <body>
+    <slot name='content' />
+  </body>
+</html>`,
+		"routes/index.html": `<Layout>
+  <slot name='content' tag='main'>
+    <p>Hello</p>
+  </slot>
+</Layout>`,
+	})
+
+	opts := testCompileOptions()
+	opts.Minify = true
+	if err := gtml.CompileProject(dir, opts); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "dist", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(html), "\n") {
+		t.Errorf("expected minified HTML without line breaks, got: %s", html)
+	}
+
+	css, err := os.ReadFile(filepath.Join(dir, "dist", "static", "styles.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(css), "\n") || strings.Contains(string(css), "/*") {
+		t.Errorf("expected minified CSS, got: %s", css)
+	}
+}
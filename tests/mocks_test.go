@@ -0,0 +1,183 @@
+package main_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phillip-england/gtml/pkg/gtml"
+)
+
+// request sends a request and returns the response and its body
+func request(t *testing.T, method string, url string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// TestMockHandler tests answering requests from the mocks directory
+func TestMockHandler(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"mocks/GET/api/users.json":              `[{"name": "Ann"}]`,
+		"mocks/GET/api/users/[id].json":         `{"name": "Any"}`,
+		"mocks/GET/api/users/admin.json":        `{"name": "Admin"}`,
+		"mocks/GET/api/teams/[id]/users.json":   `[{"name": "Member"}]`,
+		"mocks/POST/api/login.json":             `{"errors": ["bad email"]}`,
+		"mocks/POST/api/login.meta.json":        `{"status": 422, "headers": {"X-Mock": "login"}}`,
+		"mocks/DELETE/api/users/[id].json":      ``,
+		"mocks/DELETE/api/users/[id].meta.json": `{"status": 204}`,
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	server := httptest.NewServer(gtml.NewMockHandler(filepath.Join(dir, "mocks"), next))
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/api/users", 200, `[{"name": "Ann"}]`},
+		{"GET", "/api/users/", 200, `[{"name": "Ann"}]`},
+		{"GET", "/api/users/7", 200, `{"name": "Any"}`},
+		{"GET", "/api/users/admin", 200, `{"name": "Admin"}`},
+		{"GET", "/api/teams/3/users", 200, `[{"name": "Member"}]`},
+		{"POST", "/api/login", 422, `{"errors": ["bad email"]}`},
+		{"DELETE", "/api/users/7", 204, ``},
+		{"GET", "/api/login", http.StatusTeapot, ``},
+		{"GET", "/api/users/7/posts", http.StatusTeapot, ``},
+		{"GET", "/api/users.meta", http.StatusTeapot, ``},
+	}
+
+	for _, tt := range tests {
+		resp, body := request(t, tt.method, server.URL+tt.path)
+		if resp.StatusCode != tt.status || body != tt.body {
+			t.Errorf("%s %s: expected %d %q, got %d %q", tt.method, tt.path, tt.status, tt.body, resp.StatusCode, body)
+		}
+	}
+
+	resp, _ := request(t, "POST", server.URL+"/api/login")
+	if resp.Header.Get("X-Mock") != "login" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the meta headers and a JSON content type, got: %v", resp.Header)
+	}
+}
+
+// TestMockHandlerMethods tests that only HTTP methods are read from the mocks directory
+func TestMockHandlerMethods(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"secret.json":              `{"token": "secret"}`,
+		"mocks/GET/api/users.json": `[]`,
+		"mocks/BREW/coffee.json":   `{}`,
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := gtml.NewMockHandler(filepath.Join(dir, "mocks"), next)
+
+	for _, method := range []string{"..", "../..", ".", "BREW", "get"} {
+		for _, target := range []string{"/secret", "/GET/api/users", "/coffee"} {
+			req := httptest.NewRequest("GET", target, nil)
+			req.Method = method
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusTeapot || strings.Contains(recorder.Body.String(), "secret") {
+				t.Errorf("%s %s: expected the request to be passed on, got: %d %s", method, target, recorder.Code, recorder.Body.String())
+			}
+		}
+	}
+}
+
+// TestMockHandlerDelay tests the delay of a mock
+func TestMockHandlerDelay(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"mocks/GET/api/slow.json":      `{"ok": true}`,
+		"mocks/GET/api/slow.meta.json": `{"delay": "200ms"}`,
+		"mocks/GET/api/bad.json":       `{}`,
+		"mocks/GET/api/bad.meta.json":  `{"delay": "soon"}`,
+	})
+	server := httptest.NewServer(gtml.NewMockHandler(filepath.Join(dir, "mocks"), http.NotFoundHandler()))
+	defer server.Close()
+
+	start := time.Now()
+	resp, body := request(t, "GET", server.URL+"/api/slow")
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected the response to be delayed by 200ms, took %v", elapsed)
+	}
+	if resp.StatusCode != 200 || body != `{"ok": true}` {
+		t.Errorf("Unexpected delayed response: %d %s", resp.StatusCode, body)
+	}
+
+	if resp, body := request(t, "GET", server.URL+"/api/bad"); resp.StatusCode != 500 || !strings.Contains(body, "invalid delay") {
+		t.Errorf("Expected an invalid delay to fail the request, got: %d %s", resp.StatusCode, body)
+	}
+}
+
+// TestServeCompiledProjectWithMocks tests a compiled page and the mocks its fetch script requests
+func TestServeCompiledProjectWithMocks(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"routes/index.html":             `<html><body><ul fetch='GET /api/users' as='users'><p fallback='5xx'>Try again</p><li for='user in users'>{user.name}</li></ul></body></html>`,
+		"routes/about.html":             `<html><body><p>About</p></body></html>`,
+		"mocks/GET/api/users.json":      `{"error": "down"}`,
+		"mocks/GET/api/users.meta.json": `{"status": 503}`,
+	})
+	if err := gtml.CompileProject(dir, testCompileOptions()); err != nil {
+		t.Fatalf("CompileProject failed: %v", err)
+	}
+
+	handler := gtml.NewMockHandler(filepath.Join(dir, "mocks"), gtml.NewDistHandler(filepath.Join(dir, "dist")))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if _, body := request(t, "GET", server.URL+"/about"); !strings.Contains(body, "<p>About</p>") {
+		t.Errorf("Expected routes to be served without .html, got: %s", body)
+	}
+
+	_, page := request(t, "GET", server.URL+"/")
+	m := regexp.MustCompile(`fetch\('([^']+)'`).FindStringSubmatch(page)
+	if m == nil {
+		t.Fatalf("Expected the page to fetch a url, got: %s", page)
+	}
+	if !strings.Contains(page, "{ status: '5xx', template: `Try again` },") {
+		t.Errorf("Expected the page to have a 5xx fallback, got: %s", page)
+	}
+	if resp, body := request(t, "GET", server.URL+m[1]); resp.StatusCode != 503 || body != `{"error": "down"}` {
+		t.Errorf("Expected the mock to answer the page's request, got: %d %s", resp.StatusCode, body)
+	}
+}
+
+// TestStaticFetchFromMocks tests resolving a static fetch element against the mock server
+func TestStaticFetchFromMocks(t *testing.T) {
+	dir := writeTestProject(t, map[string]string{
+		"mocks/GET/api/users.json": `[{"name": "Ann"}, {"name": "Bob"}]`,
+	})
+	server := httptest.NewServer(gtml.NewMockHandler(filepath.Join(dir, "mocks"), http.NotFoundHandler()))
+	defer server.Close()
+
+	state := &gtml.GlobalState{Components: map[string]*gtml.Component{}, StaticFetchURLs: true}
+	result, err := gtml.CompileHTML(`<ul fetch='GET `+server.URL+`/api/users' as='users' static><li for='user in users'>{user.name}</li></ul>`, state, map[string]gtml.Value{}, true)
+	if err != nil {
+		t.Fatalf("CompileHTML failed: %v", err)
+	}
+	if result != "<ul><li>Ann</li><li>Bob</li></ul>" {
+		t.Errorf("Unexpected static output: %s", result)
+	}
+}